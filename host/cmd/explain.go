@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/wasm-threat-detector/host/internal/engine"
+	"github.com/wasm-threat-detector/host/internal/events"
+)
+
+var explainJSON bool
+
+// explainCmd 用所有规则检测单个事件并输出每个规则的决策过程
+var explainCmd = &cobra.Command{
+	Use:   "explain <event.json>",
+	Short: "解释规则对单个事件的决策",
+	Long: `用 --rules 指定的规则检测单个事件（"-" 表示从标准输入读取），并输出每个规则的
+处理过程：是否被预过滤条件跳过、发送的负载、规则输出、燃料消耗、返回值和解析后的结果。`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		event, err := readEvent(args[0])
+		if err != nil {
+			return err
+		}
+
+		// 规则输出已记录在追踪结果中，日志只保留警告
+		logger := logrus.New()
+		logger.SetOutput(os.Stderr)
+		logger.SetLevel(logrus.WarnLevel)
+
+		cfg := loadEngineConfig(logger)
+		cfg.Trace.Enabled = true
+
+		wasmEngine := engine.NewSimpleEngineWithConfig(logger, cfg)
+		defer wasmEngine.Close()
+
+		if err := loadRules(wasmEngine, viper.GetString("rules"), logger); err != nil {
+			return err
+		}
+
+		results, traces, err := wasmEngine.Explain(context.Background(), event)
+		if err != nil {
+			return err
+		}
+
+		if explainJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(struct {
+				Event   *events.Event             `json:"event"`
+				Traces  []*engine.RuleTrace       `json:"traces"`
+				Results []*events.DetectionResult `json:"results"`
+			}{event, traces, results})
+		}
+
+		printExplanation(os.Stdout, event, traces, results)
+		return nil
+	},
+}
+
+// readEvent 从文件或标准输入读取事件 JSON
+func readEvent(path string) (*events.Event, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read event: %w", err)
+	}
+
+	event, err := events.FromJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse event: %w", err)
+	}
+	if event.ID == "" {
+		event.ID = "explain"
+	}
+
+	return event, nil
+}
+
+// printExplanation 以文本形式输出追踪记录
+func printExplanation(w io.Writer, event *events.Event, traces []*engine.RuleTrace, results []*events.DetectionResult) {
+	fmt.Fprintf(w, "Event %s (type %s, schema version %d)\n", event.ID, event.Type, event.SchemaVersion)
+
+	for _, trace := range traces {
+		fmt.Fprintf(w, "\n[%s] %s: %s", trace.Kind, trace.Rule, trace.Decision)
+		if trace.Decision == engine.TraceSkipped {
+			fmt.Fprintln(w, " by prefilter")
+			continue
+		}
+		fmt.Fprintf(w, " (schema version %d, return %d, fuel %d, %s)\n",
+			trace.SchemaVersion, trace.ReturnValue, trace.FuelUsed, trace.Duration)
+
+		if len(trace.Payload) > 0 {
+			truncated := ""
+			if trace.Truncated {
+				truncated = " (truncated)"
+			}
+			fmt.Fprintf(w, "  payload%s: %s\n", truncated, trace.Payload)
+		}
+		for _, out := range trace.Output {
+			fmt.Fprintf(w, "  %s: %s\n", out.Stream, out.Line)
+		}
+		if len(trace.Result) > 0 {
+			fmt.Fprintf(w, "  result: %s\n", trace.Result)
+		}
+		for _, f := range trace.Findings {
+			status := "reported"
+			if !f.Reported {
+				status = "filtered"
+			}
+			id := f.SubRuleID
+			if id == "" {
+				id = "-"
+			}
+			fmt.Fprintf(w, "  finding: %s level %d severity %s (%s)\n", id, f.ThreatLevel, f.Severity, status)
+		}
+		if trace.Error != "" {
+			fmt.Fprintf(w, "  error: %s\n", trace.Error)
+		}
+	}
+
+	fmt.Fprintln(w)
+	printDetections(w, results)
+}
+
+// printDetections 输出检测结果列表
+func printDetections(w io.Writer, results []*events.DetectionResult) {
+	fmt.Fprintf(w, "%d detections\n", len(results))
+	for _, result := range results {
+		name := result.RuleName
+		if result.SubRuleID != "" {
+			name += "/" + result.SubRuleID
+		}
+		fmt.Fprintf(w, "  %-32s %-8s %s\n", name, strings.ToUpper(result.Severity), result.Description)
+	}
+}
+
+func init() {
+	explainCmd.Flags().BoolVar(&explainJSON, "json", false, "以 JSON 格式输出")
+
+	rootCmd.AddCommand(explainCmd)
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
@@ -10,6 +12,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/mitchellh/mapstructure"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -17,6 +20,7 @@ import (
 	"github.com/wasm-threat-detector/host/internal/engine"
 	"github.com/wasm-threat-detector/host/internal/events"
 	"github.com/wasm-threat-detector/host/internal/output"
+	"github.com/wasm-threat-detector/host/internal/procfs"
 )
 
 var (
@@ -26,6 +30,7 @@ var (
 	logFile     string
 	webhookURL  string
 	metricsPort int
+	hostRoot    string
 )
 
 // rootCmd 代表基本命令
@@ -57,6 +62,7 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&logFile, "log-file", "", "日志文件路径")
 	rootCmd.PersistentFlags().StringVar(&webhookURL, "webhook", "", "Webhook URL for alerts")
 	rootCmd.PersistentFlags().IntVar(&metricsPort, "metrics-port", 8080, "Prometheus 指标端口")
+	rootCmd.PersistentFlags().StringVar(&hostRoot, "host-root", "/", "被监控系统的根目录，从其下的 proc 和 etc 读取（容器中可挂载宿主机根目录）")
 
 	// 绑定标志到 viper
 	viper.BindPFlag("rules", rootCmd.PersistentFlags().Lookup("rules"))
@@ -64,6 +70,7 @@ func init() {
 	viper.BindPFlag("log-file", rootCmd.PersistentFlags().Lookup("log-file"))
 	viper.BindPFlag("webhook", rootCmd.PersistentFlags().Lookup("webhook"))
 	viper.BindPFlag("metrics-port", rootCmd.PersistentFlags().Lookup("metrics-port"))
+	viper.BindPFlag("host-root", rootCmd.PersistentFlags().Lookup("host-root"))
 }
 
 // initConfig 读取配置文件和环境变量
@@ -99,8 +106,8 @@ func run() {
 	defer cancel()
 
 	// 创建 Wasm 引擎
-	wasmEngine := engine.NewSimpleEngine(logger)
-	defer wasmEngine.Close()
+	engineConfig := loadEngineConfig(logger)
+	var wasmEngine engine.ThreatEngine = engine.NewSimpleEngineWithConfig(logger, engineConfig)
 
 	// 加载规则
 	rulesPath := viper.GetString("rules")
@@ -108,6 +115,20 @@ func run() {
 		logger.Fatalf("Failed to load rules: %v", err)
 	}
 
+	// 加载候选版本规则，与当前版本并行比较
+	compareConfig := loadCompareConfig(logger)
+	if len(compareConfig.Rules) > 0 {
+		comparison := engine.NewComparisonEngine(logger, wasmEngine, engine.NewSimpleEngineWithConfig(logger, engineConfig))
+		for name, path := range compareConfig.Rules {
+			if err := comparison.LoadCandidate(name, path); err != nil {
+				logger.Fatalf("Failed to load candidate rule: %v", err)
+			}
+		}
+		wasmEngine = comparison
+		go reportDivergence(ctx, comparison, compareConfig.ReportInterval)
+	}
+	defer wasmEngine.Close()
+
 	// 创建输出处理器
 	outputHandler, err := createOutputHandler(logger)
 	if err != nil {
@@ -116,7 +137,8 @@ func run() {
 	defer outputHandler.Close()
 
 	// 创建事件收集器
-	collectors := createCollectors(logger)
+	proc := openHostRoot(logger)
+	collectors := createCollectors(logger, proc)
 
 	// 启动收集器
 	for _, col := range collectors {
@@ -128,11 +150,11 @@ func run() {
 
 	// 启动 Prometheus 指标服务器
 	if prometheusHandler, ok := outputHandler.(*output.MultiOutputHandler); ok {
-		go startMetricsServer(logger, prometheusHandler)
+		go startMetricsServer(logger, prometheusHandler, wasmEngine)
 	}
 
 	// 处理事件
-	go processEvents(ctx, wasmEngine, collectors, outputHandler, logger)
+	go processEvents(ctx, wasmEngine, collectors, outputHandler, engineConfig.TickInterval, logger)
 
 	logger.Info("WASM-ThreatDetector started successfully")
 
@@ -178,6 +200,69 @@ func setupLogger() *logrus.Logger {
 	return logger
 }
 
+// loadEngineConfig 从配置文件读取引擎配置
+func loadEngineConfig(logger *logrus.Logger) engine.Config {
+	cfg := engine.DefaultConfig()
+
+	if err := viper.UnmarshalKey("engine.rule_output", &cfg.RuleOutput); err != nil {
+		logger.Fatalf("Invalid engine.rule_output config: %v", err)
+	}
+	if err := viper.UnmarshalKey("engine.scoring", &cfg.Scoring); err != nil {
+		logger.Fatalf("Invalid engine.scoring config: %v", err)
+	}
+	if err := viper.UnmarshalKey("filters", &cfg.Filters); err != nil {
+		logger.Fatalf("Invalid filters config: %v", err)
+	}
+	if err := viper.UnmarshalKey("rule_config", &cfg.Rules); err != nil {
+		logger.Fatalf("Invalid rule_config config: %v", err)
+	}
+	if viper.IsSet("engine.tick_interval") {
+		cfg.TickInterval = viper.GetDuration("engine.tick_interval")
+	}
+	if viper.IsSet("engine.max_memory_mb") {
+		cfg.MaxMemoryMB = viper.GetInt("engine.max_memory_mb")
+	}
+	if err := viper.UnmarshalKey("engine.trace", &cfg.Trace); err != nil {
+		logger.Fatalf("Invalid engine.trace config: %v", err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		logger.Fatalf("Invalid engine config: %v", err)
+	}
+
+	return cfg
+}
+
+// loadCompareConfig 从配置文件读取 A/B 比较配置
+func loadCompareConfig(logger *logrus.Logger) engine.CompareConfig {
+	cfg := engine.CompareConfig{ReportInterval: 5 * time.Minute}
+
+	if err := viper.UnmarshalKey("compare", &cfg); err != nil {
+		logger.Fatalf("Invalid compare config: %v", err)
+	}
+	if cfg.ReportInterval <= 0 {
+		logger.Fatalf("Invalid compare config: report_interval must be positive")
+	}
+
+	return cfg
+}
+
+// reportDivergence 定期输出候选版本规则的分歧报告
+func reportDivergence(ctx context.Context, comparison *engine.ComparisonEngine, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			comparison.LogReport()
+			return
+		case <-ticker.C:
+			comparison.LogReport()
+		}
+	}
+}
+
 // loadRules 加载 Wasm 规则
 func loadRules(wasmEngine engine.ThreatEngine, rulesPath string, logger *logrus.Logger) error {
 	// 检查路径是文件还是目录
@@ -235,23 +320,55 @@ func createOutputHandler(logger *logrus.Logger) (output.OutputHandler, error) {
 	return output.NewMultiOutputHandler(logger, handlers...), nil
 }
 
-// createCollectors 创建事件收集器
-func createCollectors(logger *logrus.Logger) []collector.Collector {
-	var collectors []collector.Collector
+// openHostRoot 返回读取 host-root 下 procfs 的 FS，根目录下没有 procfs 时退出
+func openHostRoot(logger *logrus.Logger) *procfs.FS {
+	root := viper.GetString("host-root")
+	proc := procfs.Host(root)
+	if _, err := proc.PIDs(); err != nil {
+		logger.Fatalf("Invalid host root %s: %v", root, err)
+	}
+	return proc
+}
+
+// createCollectors 按配置文件的 collectors 段创建启用的事件收集器，收集器从 proc 读取 procfs
+func createCollectors(logger *logrus.Logger, proc *procfs.FS) []collector.Collector {
+	var configured []string
+	for name := range viper.GetStringMap("collectors") {
+		configured = append(configured, name)
+	}
 
-	// 进程收集器
-	processCollector := collector.NewProcessCollector(logger)
-	collectors = append(collectors, processCollector)
+	// 拒绝未知的配置项，避免拼写错误的选项被静默忽略
+	decode := func(name string, cfg interface{}) error {
+		err := viper.UnmarshalKey("collectors."+name, cfg, func(dc *mapstructure.DecoderConfig) {
+			dc.ErrorUnused = true
+		})
+		return decodeError(err)
+	}
 
-	// 网络收集器
-	networkCollector := collector.NewNetworkCollector(logger)
-	collectors = append(collectors, networkCollector)
+	collectors, err := collector.NewCollectors(logger, proc, configured, decode)
+	if err != nil {
+		logger.Fatalf("Failed to create collectors: %v", err)
+	}
 
 	return collectors
 }
 
+// decodeError 将 mapstructure 的多行错误合并为一行，根对象的未知配置项表述为 unknown options
+func decodeError(err error) error {
+	var decodeErr *mapstructure.Error
+	if !errors.As(err, &decodeErr) {
+		return err
+	}
+
+	messages := make([]string, 0, len(decodeErr.Errors))
+	for _, message := range decodeErr.Errors {
+		messages = append(messages, strings.Replace(message, "'' has invalid keys", "unknown options", 1))
+	}
+	return errors.New(strings.Join(messages, "; "))
+}
+
 // processEvents 处理事件
-func processEvents(ctx context.Context, wasmEngine engine.ThreatEngine, collectors []collector.Collector, outputHandler output.OutputHandler, logger *logrus.Logger) {
+func processEvents(ctx context.Context, wasmEngine engine.ThreatEngine, collectors []collector.Collector, outputHandler output.OutputHandler, tickInterval time.Duration, logger *logrus.Logger) {
 	// 合并所有收集器的事件通道
 	eventChan := make(chan *events.Event, 1000)
 
@@ -270,6 +387,10 @@ func processEvents(ctx context.Context, wasmEngine engine.ThreatEngine, collecto
 		}(col)
 	}
 
+	// 定时调用规则的 tick 钩子
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+
 	// 处理事件
 	for {
 		select {
@@ -283,18 +404,57 @@ func processEvents(ctx context.Context, wasmEngine engine.ThreatEngine, collecto
 				continue
 			}
 
-			// 处理检测结果
-			for _, result := range results {
-				if err := outputHandler.Handle(result); err != nil {
-					logger.Warnf("Failed to handle detection result: %v", err)
-				}
+			handleResults(outputHandler, results, logger)
+		case now := <-ticker.C:
+			results, err := wasmEngine.Tick(ctx, now)
+			if err != nil {
+				logger.Warnf("Rule tick failed: %v", err)
+				continue
 			}
+
+			handleResults(outputHandler, results, logger)
+		}
+	}
+}
+
+// handleResults 将检测结果交给输出处理器
+func handleResults(outputHandler output.OutputHandler, results []*events.DetectionResult, logger *logrus.Logger) {
+	for _, result := range results {
+		if err := outputHandler.Handle(result); err != nil {
+			logger.Warnf("Failed to handle detection result: %v", err)
 		}
 	}
 }
 
+// writeRuleMetrics 输出规则调用统计
+func writeRuleMetrics(w io.Writer, stats []engine.RuleStats) {
+	fmt.Fprintln(w, "# HELP wasm_threat_detector_rule_invocations_total Number of times a rule module was invoked")
+	fmt.Fprintln(w, "# TYPE wasm_threat_detector_rule_invocations_total counter")
+	for _, s := range stats {
+		fmt.Fprintf(w, "wasm_threat_detector_rule_invocations_total{rule=%q,kind=%q} %d\n", s.Rule, s.Kind, s.Invocations)
+	}
+
+	fmt.Fprintln(w, "# HELP wasm_threat_detector_rule_skipped_total Number of rule invocations skipped by manifest prefilters")
+	fmt.Fprintln(w, "# TYPE wasm_threat_detector_rule_skipped_total counter")
+	for _, s := range stats {
+		fmt.Fprintf(w, "wasm_threat_detector_rule_skipped_total{rule=%q,kind=%q} %d\n", s.Rule, s.Kind, s.Skipped)
+	}
+
+	fmt.Fprintln(w, "# HELP wasm_threat_detector_rule_memory_grown_total Number of times rule memory was grown to fit an event")
+	fmt.Fprintln(w, "# TYPE wasm_threat_detector_rule_memory_grown_total counter")
+	for _, s := range stats {
+		fmt.Fprintf(w, "wasm_threat_detector_rule_memory_grown_total{rule=%q,kind=%q} %d\n", s.Rule, s.Kind, s.Grown)
+	}
+
+	fmt.Fprintln(w, "# HELP wasm_threat_detector_rule_truncated_total Number of events truncated to fit rule memory")
+	fmt.Fprintln(w, "# TYPE wasm_threat_detector_rule_truncated_total counter")
+	for _, s := range stats {
+		fmt.Fprintf(w, "wasm_threat_detector_rule_truncated_total{rule=%q,kind=%q} %d\n", s.Rule, s.Kind, s.Truncated)
+	}
+}
+
 // startMetricsServer 启动 Prometheus 指标服务器
-func startMetricsServer(logger *logrus.Logger, multiHandler *output.MultiOutputHandler) {
+func startMetricsServer(logger *logrus.Logger, multiHandler *output.MultiOutputHandler, wasmEngine engine.ThreatEngine) {
 	port := viper.GetInt("metrics-port")
 
 	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
@@ -304,6 +464,8 @@ func startMetricsServer(logger *logrus.Logger, multiHandler *output.MultiOutputH
 		w.Write([]byte("# HELP wasm_threat_detector_total_threats Total number of threats detected\n"))
 		w.Write([]byte("# TYPE wasm_threat_detector_total_threats counter\n"))
 		w.Write([]byte(fmt.Sprintf("wasm_threat_detector_total_threats %d\n", time.Now().Unix())))
+
+		writeRuleMetrics(w, wasmEngine.Stats())
 	})
 
 	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
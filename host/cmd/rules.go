@@ -0,0 +1,418 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/wasm-threat-detector/host/internal/bundle"
+	"github.com/wasm-threat-detector/host/internal/engine"
+	"github.com/wasm-threat-detector/host/internal/events"
+	"github.com/wasm-threat-detector/host/internal/ruletest"
+	"github.com/wasm-threat-detector/host/internal/scaffold"
+)
+
+var (
+	packWasm      string
+	packOutput    string
+	packSignKey   string
+	trustedKey    string
+	removeVersion string
+	keygenOut     string
+	newLang       string
+	newDir        string
+	testWasm      string
+)
+
+// rulesCmd 规则管理命令
+var rulesCmd = &cobra.Command{
+	Use:   "rules",
+	Short: "管理 Wasm 检测规则",
+	Long: `创建、测试、打包、安装、删除、列出和检查 Wasm 检测规则。
+
+已安装的规则位于 --rules 指定的目录中，每个规则的历史版本保存在
+.versions 子目录下，可以回滚到上一个版本。`,
+}
+
+// rulesPackCmd 打包规则
+var rulesPackCmd = &cobra.Command{
+	Use:   "pack <rule-dir>",
+	Short: "将规则目录打包为规则包",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var signKey ed25519.PrivateKey
+		if packSignKey != "" {
+			key, err := bundle.ReadPrivateKey(packSignKey)
+			if err != nil {
+				return err
+			}
+			signKey = key
+		}
+
+		manifest, err := bundle.Pack(args[0], packWasm, packOutput, signKey)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Packed %s %s into %s\n", manifest.Name, manifest.Version, packOutput)
+		return nil
+	},
+}
+
+// rulesInstallCmd 安装规则
+var rulesInstallCmd = &cobra.Command{
+	Use:   "install <bundle|dir>",
+	Short: "安装规则包或规则目录并激活",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openRuleStore()
+		if err != nil {
+			return err
+		}
+
+		rule, err := store.Install(args[0])
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Installed %s %s\n", rule.Name, rule.Active)
+		return nil
+	},
+}
+
+// rulesRemoveCmd 删除规则
+var rulesRemoveCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "删除已安装的规则或规则的某个版本",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openRuleStore()
+		if err != nil {
+			return err
+		}
+
+		if err := store.Remove(args[0], removeVersion); err != nil {
+			return err
+		}
+
+		if removeVersion != "" {
+			fmt.Printf("Removed %s %s\n", args[0], removeVersion)
+		} else {
+			fmt.Printf("Removed %s\n", args[0])
+		}
+		return nil
+	},
+}
+
+// rulesRollbackCmd 回滚规则
+var rulesRollbackCmd = &cobra.Command{
+	Use:   "rollback <name>",
+	Short: "回滚规则到上一个版本",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openRuleStore()
+		if err != nil {
+			return err
+		}
+
+		rule, err := store.Rollback(args[0])
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Rolled back %s to %s\n", rule.Name, rule.Active)
+		return nil
+	},
+}
+
+// rulesListCmd 列出规则
+var rulesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "列出已安装的规则",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openRuleStore()
+		if err != nil {
+			return err
+		}
+
+		rules, err := store.List()
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%-24s %-12s %-10s %s\n", "NAME", "ACTIVE", "INTEGRITY", "VERSIONS")
+		for _, rule := range rules {
+			integrity := "ok"
+			if rule.Verified != nil {
+				integrity = "FAILED"
+			}
+			fmt.Printf("%-24s %-12s %-10s %s\n", rule.Name, rule.Active, integrity, strings.Join(rule.Versions, ","))
+			if rule.Verified != nil {
+				fmt.Fprintf(os.Stderr, "  %s: %v\n", rule.Name, rule.Verified)
+			}
+		}
+		return nil
+	},
+}
+
+// rulesInspectCmd 检查 Wasm 模块
+var rulesInspectCmd = &cobra.Command{
+	Use:   "inspect <file.wasm>",
+	Short: "显示 Wasm 规则的导出、导入、内存限制、ABI 版本和清单信息",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		wasmPath := args[0]
+
+		info, err := engine.Inspect(wasmPath)
+		if info == nil {
+			return err
+		}
+
+		fmt.Printf("Module: %s\n", wasmPath)
+		if err != nil {
+			fmt.Printf("ABI version: unknown (%v)\n", err)
+		} else {
+			fmt.Printf("ABI version: %d (host: %d)\n", info.ABIVersion, engine.CurrentABIVersion)
+		}
+
+		if info.Memory != nil {
+			max := "unlimited"
+			if info.Memory.HasMax {
+				max = fmt.Sprintf("%d pages", info.Memory.MaxPages)
+			}
+			fmt.Printf("Memory: min %d pages, max %s\n", info.Memory.MinPages, max)
+		}
+
+		fmt.Println("\nExports:")
+		for _, exp := range info.Exports {
+			fmt.Printf("  %-24s %-8s %s\n", exp.Name, exp.Kind, exp.Signature)
+		}
+
+		fmt.Println("\nImports:")
+		for _, imp := range info.Imports {
+			fmt.Printf("  %-40s %-8s %s\n", imp.Module+"."+imp.Name, imp.Kind, imp.Signature)
+		}
+
+		manifest, manifestErr := engine.LoadManifest(wasmPath)
+		kind := engine.KindDetector
+		if manifestErr == nil {
+			kind = manifest.RuleKind()
+		}
+
+		fmt.Println("\nManifest:")
+		switch {
+		case manifestErr != nil:
+			fmt.Printf("  invalid: %v\n", manifestErr)
+		case engine.ManifestPath(wasmPath) == "":
+			fmt.Println("  none")
+		default:
+			fmt.Printf("  path:        %s\n", engine.ManifestPath(wasmPath))
+			fmt.Printf("  name:        %s\n", manifest.Name)
+			fmt.Printf("  version:     %s\n", manifest.Version)
+			fmt.Printf("  description: %s\n", manifest.Description)
+			fmt.Printf("  kind:        %s\n", kind)
+			if kind == engine.KindEnricher {
+				fmt.Printf("  order:       %d\n", manifest.Order)
+			}
+			for _, dir := range manifest.Capabilities.Dirs {
+				fmt.Printf("  dir:         %s -> %s (not supported)\n", dir.Host, dir.Guest)
+			}
+			for _, env := range manifest.Capabilities.Env {
+				fmt.Printf("  env:         %s\n", env)
+			}
+			fmt.Printf("  clock:       %t\n", manifest.Capabilities.Clock)
+			if len(manifest.SchemaVersions) > 0 {
+				fmt.Printf("  schema:      %v (host: %d)\n", manifest.SchemaVersions, events.CurrentSchemaVersion)
+			} else {
+				fmt.Printf("  schema:      not declared, assuming 1 (host: %d)\n", events.CurrentSchemaVersion)
+			}
+		}
+
+		// 校验结果
+		fmt.Println("\nValidation:")
+		problems := 0
+		if err != nil {
+			fmt.Printf("  FAIL %v\n", err)
+			problems++
+		}
+		if err := info.Validate(kind); err != nil {
+			fmt.Printf("  FAIL %v\n", err)
+			problems++
+		}
+		if manifestErr == nil {
+			if err := info.CheckCapabilities(manifest); err != nil {
+				fmt.Printf("  FAIL %v\n", err)
+				problems++
+			}
+			if _, err := manifest.EventSchemaVersion(); err != nil {
+				fmt.Printf("  FAIL %v\n", err)
+				problems++
+			}
+		}
+		if problems > 0 {
+			return fmt.Errorf("module %s failed validation", wasmPath)
+		}
+		fmt.Println("  OK")
+
+		return nil
+	},
+}
+
+// rulesNewCmd 生成规则项目
+var rulesNewCmd = &cobra.Command{
+	Use:   "new <name>",
+	Short: "生成实现当前宿主 ABI 的规则项目",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		dir := newDir
+		if dir == "" {
+			dir = name
+		}
+
+		files, err := scaffold.Generate(dir, name, newLang)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Created %s rule %s in %s (ABI version %d)\n", newLang, name, dir, engine.CurrentABIVersion)
+		for _, file := range files {
+			fmt.Printf("  %s\n", file)
+		}
+		fmt.Printf("\nBuild and run the fixtures with:\n  cd %s && make test\n", dir)
+		return nil
+	},
+}
+
+// rulesTestCmd 运行规则测试用例
+var rulesTestCmd = &cobra.Command{
+	Use:   "test <rule-dir>",
+	Short: "用规则目录 fixtures/ 中的用例测试规则",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ruleDir := args[0]
+
+		wasmPath := testWasm
+		if wasmPath == "" {
+			path, err := bundle.FindWasm(ruleDir)
+			if err != nil {
+				return err
+			}
+			wasmPath = path
+		}
+
+		manifest, err := engine.LoadManifest(wasmPath)
+		if err != nil {
+			return err
+		}
+		name := manifest.Name
+		if name == "" {
+			name = strings.TrimSuffix(filepath.Base(wasmPath), ".wasm")
+		}
+
+		fixtures, err := ruletest.LoadFixtures(filepath.Join(ruleDir, bundle.FixturesDir))
+		if err != nil {
+			return err
+		}
+		if len(fixtures) == 0 {
+			return fmt.Errorf("no fixtures found in %s", filepath.Join(ruleDir, bundle.FixturesDir))
+		}
+
+		// 规则日志只在失败时有意义，默认只输出警告
+		logger := logrus.New()
+		logger.SetLevel(logrus.WarnLevel)
+
+		results, err := ruletest.Run(logger, name, wasmPath, fixtures)
+		if err != nil {
+			return err
+		}
+
+		failed := 0
+		for _, result := range results {
+			if result.Passed() {
+				fmt.Printf("PASS %s (%d detections)\n", result.Fixture, len(result.Results))
+				continue
+			}
+			failed++
+			fmt.Printf("FAIL %s\n", result.Fixture)
+			for _, problem := range result.Problems {
+				fmt.Printf("  %s\n", problem)
+			}
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d of %d fixtures failed", failed, len(results))
+		}
+		fmt.Printf("ok  %s %d fixtures\n", name, len(results))
+		return nil
+	},
+}
+
+// rulesKeygenCmd 生成签名密钥
+var rulesKeygenCmd = &cobra.Command{
+	Use:   "keygen",
+	Short: "生成规则包签名密钥对",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		public, private, err := bundle.GenerateKey()
+		if err != nil {
+			return err
+		}
+
+		if err := os.WriteFile(keygenOut+".key", []byte(private+"\n"), 0600); err != nil {
+			return err
+		}
+		if err := os.WriteFile(keygenOut+".pub", []byte(public+"\n"), 0644); err != nil {
+			return err
+		}
+
+		fmt.Printf("Wrote %s.key and %s.pub\n", keygenOut, keygenOut)
+		return nil
+	},
+}
+
+func init() {
+	rulesPackCmd.Flags().StringVar(&packWasm, "wasm", "", "Wasm 文件路径 (默认使用规则目录下唯一的 .wasm 文件)")
+	rulesPackCmd.Flags().StringVarP(&packOutput, "output", "o", "rule.tar.gz", "规则包输出路径")
+	rulesPackCmd.Flags().StringVar(&packSignKey, "sign-key", "", "签名私钥文件")
+
+	rulesCmd.PersistentFlags().StringVar(&trustedKey, "trusted-key", "", "验签公钥文件，设置后只接受签名有效的规则包")
+	viper.BindPFlag("trusted-key", rulesCmd.PersistentFlags().Lookup("trusted-key"))
+
+	rulesRemoveCmd.Flags().StringVar(&removeVersion, "version", "", "只删除指定版本")
+
+	rulesKeygenCmd.Flags().StringVar(&keygenOut, "out", "rules-signing", "密钥文件前缀")
+
+	rulesNewCmd.Flags().StringVar(&newLang, "lang", "rust", "规则语言 ("+strings.Join(scaffold.Languages, ", ")+")")
+	rulesNewCmd.Flags().StringVar(&newDir, "dir", "", "项目目录 (默认使用规则名)")
+
+	rulesTestCmd.Flags().StringVar(&testWasm, "wasm", "", "Wasm 文件路径 (默认使用规则目录下唯一的 .wasm 文件)")
+
+	rulesCmd.AddCommand(rulesPackCmd, rulesInstallCmd, rulesRemoveCmd, rulesRollbackCmd, rulesListCmd, rulesInspectCmd, rulesKeygenCmd, rulesNewCmd, rulesTestCmd)
+	rootCmd.AddCommand(rulesCmd)
+}
+
+// openRuleStore 打开 --rules 指定的已安装规则目录
+func openRuleStore() (*bundle.Store, error) {
+	rulesPath := viper.GetString("rules")
+	if info, err := os.Stat(rulesPath); err == nil && !info.IsDir() {
+		return nil, fmt.Errorf("rules path %s is not a directory", rulesPath)
+	}
+
+	var key ed25519.PublicKey
+	if path := viper.GetString("trusted-key"); path != "" {
+		k, err := bundle.ReadPublicKey(path)
+		if err != nil {
+			return nil, err
+		}
+		key = k
+	}
+
+	return bundle.NewStore(rulesPath, key), nil
+}
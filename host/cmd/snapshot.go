@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/wasm-threat-detector/host/internal/collector"
+	"github.com/wasm-threat-detector/host/internal/engine"
+	"github.com/wasm-threat-detector/host/internal/events"
+	"github.com/wasm-threat-detector/host/internal/procfs"
+	"github.com/wasm-threat-detector/host/internal/snapshot"
+)
+
+var analyzeJSON bool
+
+// snapshotCmd 采集 procfs 和 /etc 的快照
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot <archive.tar.gz>",
+	Short: "采集系统状态快照，用于离线分析",
+	Long: `采集 --host-root 下收集器会读取的 procfs 文件（进程的 stat、status、cmdline、exe 和
+文件描述符，/proc/net 下的套接字表）以及 /etc/passwd、/etc/group，写入 tar.gz 归档。
+快照中包含进程的命令行参数，归档以 0600 权限创建。`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root := viper.GetString("host-root")
+		proc := procfs.Host(root)
+
+		file, err := os.OpenFile(args[0], os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to create snapshot: %w", err)
+		}
+
+		meta, err := snapshot.Capture(file, proc)
+		if closeErr := file.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("failed to write snapshot: %w", closeErr)
+		}
+		if err != nil {
+			os.Remove(args[0])
+			return err
+		}
+
+		fmt.Printf("Captured %d processes from %s (%s) to %s\n", meta.Processes, meta.Hostname, root, args[0])
+		return nil
+	},
+}
+
+// analyzeCmd 对快照运行收集器和规则
+var analyzeCmd = &cobra.Command{
+	Use:   "analyze <archive.tar.gz>",
+	Short: "用规则离线分析系统状态快照",
+	Long: `从快照中读取 procfs，按配置文件的 collectors 段创建收集器并扫描一次，
+再用 --rules 指定的规则检测生成的事件。快照只记录了某一时刻的状态，
+因此只会生成进程的 create 和 suspicious_activity 事件以及网络的 open、listen 和 raw 事件，
+采集时已处于 TIME_WAIT 的连接会同时生成 open 和 close 事件，但没有字节计数；文件收集器只能监控本机，会被跳过。`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logger := logrus.New()
+		logger.SetOutput(os.Stderr)
+		logger.SetLevel(logrus.WarnLevel)
+
+		snap, err := snapshot.Open(args[0])
+		if err != nil {
+			return err
+		}
+
+		wasmEngine := engine.NewSimpleEngineWithConfig(logger, loadEngineConfig(logger))
+		defer wasmEngine.Close()
+
+		if err := loadRules(wasmEngine, viper.GetString("rules"), logger); err != nil {
+			return err
+		}
+
+		collected, err := scanSnapshot(logger, createCollectors(logger, snap.FS()))
+		if err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+		var results []*events.DetectionResult
+		for _, event := range collected {
+			detected, err := wasmEngine.DetectThreat(ctx, event)
+			if err != nil {
+				logger.Warnf("Threat detection failed for event %s: %v", event.ID, err)
+				continue
+			}
+			results = append(results, detected...)
+		}
+		// 规则的 tick 钩子以快照时间调用一次，使按时间窗口聚合的规则输出结果
+		ticked, err := wasmEngine.Tick(ctx, snap.Metadata.CapturedAt)
+		if err != nil {
+			logger.Warnf("Rule tick failed: %v", err)
+		}
+		results = append(results, ticked...)
+
+		if analyzeJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(struct {
+				Snapshot snapshot.Metadata         `json:"snapshot"`
+				Events   []*events.Event           `json:"events"`
+				Results  []*events.DetectionResult `json:"results"`
+			}{snap.Metadata, collected, results})
+		}
+
+		printAnalysis(os.Stdout, snap.Metadata, collected, results)
+		return nil
+	},
+}
+
+// scanSnapshot 让每个收集器扫描一次并返回生成的事件，不支持离线扫描的收集器被跳过
+func scanSnapshot(logger *logrus.Logger, collectors []collector.Collector) ([]*events.Event, error) {
+	var collected []*events.Event
+	for _, col := range collectors {
+		scanner, ok := col.(collector.Scanner)
+		if !ok {
+			logger.Warnf("Skipping %T, it can only monitor a live system", col)
+			continue
+		}
+
+		// 扫描时同时接收事件，避免事件通道写满后被丢弃
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for event := range scanner.EventChannel() {
+				collected = append(collected, event)
+			}
+		}()
+
+		err := scanner.ScanOnce()
+		scanner.Stop()
+		<-done
+		if err != nil {
+			return nil, err
+		}
+	}
+	return collected, nil
+}
+
+// printAnalysis 以文本形式输出分析结果
+func printAnalysis(w io.Writer, meta snapshot.Metadata, collected []*events.Event, results []*events.DetectionResult) {
+	fmt.Fprintf(w, "Snapshot of %s captured at %s (%d processes)\n",
+		meta.Hostname, meta.CapturedAt.Format(time.RFC3339), meta.Processes)
+
+	counts := make(map[string]int)
+	for _, event := range collected {
+		action, _ := event.Data["action"].(string)
+		counts[string(event.Type)+" "+action]++
+	}
+	kinds := make([]string, 0, len(counts))
+	for kind := range counts {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	fmt.Fprintf(w, "\n%d events\n", len(collected))
+	for _, kind := range kinds {
+		fmt.Fprintf(w, "  %-32s %d\n", kind, counts[kind])
+	}
+
+	fmt.Fprintln(w)
+	printDetections(w, results)
+}
+
+func init() {
+	analyzeCmd.Flags().BoolVar(&analyzeJSON, "json", false, "以 JSON 格式输出，包括生成的所有事件")
+
+	rootCmd.AddCommand(snapshotCmd)
+	rootCmd.AddCommand(analyzeCmd)
+}
@@ -0,0 +1,443 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/wasm-threat-detector/host/internal/engine"
+)
+
+// 规则包内的文件名
+const (
+	WasmFile      = "rule.wasm"
+	ManifestFile  = "manifest.yaml"
+	FixturesDir   = "fixtures"
+	ChecksumsFile = "checksums.sha256"
+	SignatureFile = "signature"
+)
+
+// maxEntrySize 规则包内单个文件的最大尺寸
+const maxEntrySize = 64 << 20
+
+// ErrUnsigned 规则包没有签名
+var ErrUnsigned = errors.New("bundle is not signed")
+
+// Pack 将规则目录打包为 tar.gz 规则包
+//
+// 规则目录需要包含 manifest.yaml；wasmPath 为空时使用目录下唯一的 .wasm 文件。
+// fixtures 目录存在时一并打包。signKey 不为空时对校验和文件签名。
+func Pack(ruleDir, wasmPath, outPath string, signKey ed25519.PrivateKey) (*engine.RuleManifest, error) {
+	manifestPath := filepath.Join(ruleDir, ManifestFile)
+	manifest, err := readBundleManifest(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if wasmPath == "" {
+		wasmPath, err = FindWasm(ruleDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 规则包内路径 -> 宿主路径
+	files := map[string]string{
+		ManifestFile: manifestPath,
+		WasmFile:     wasmPath,
+	}
+
+	fixturesPath := filepath.Join(ruleDir, FixturesDir)
+	if info, err := os.Stat(fixturesPath); err == nil && info.IsDir() {
+		err := filepath.Walk(fixturesPath, func(path string, info os.FileInfo, err error) error {
+			if err != nil || !info.Mode().IsRegular() {
+				return err
+			}
+			rel, err := filepath.Rel(ruleDir, path)
+			if err != nil {
+				return err
+			}
+			files[filepath.ToSlash(rel)] = path
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to collect fixtures: %w", err)
+		}
+	}
+
+	contents := make(map[string][]byte, len(files)+2)
+	for name, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		contents[name] = data
+	}
+
+	checksums := formatChecksums(contents)
+	contents[ChecksumsFile] = checksums
+	if signKey != nil {
+		contents[SignatureFile] = []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(signKey, checksums)) + "\n")
+	}
+
+	if err := writeArchive(outPath, contents); err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// Extract 将 tar.gz 规则包解压到目标目录
+func Extract(bundlePath, destDir string) error {
+	file, err := os.Open(bundlePath)
+	if err != nil {
+		return fmt.Errorf("failed to open bundle %s: %w", bundlePath, err)
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("failed to read bundle %s: %w", bundlePath, err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read bundle %s: %w", bundlePath, err)
+		}
+
+		name := filepath.Clean(filepath.FromSlash(header.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("bundle entry %q escapes the bundle", header.Name)
+		}
+		target := filepath.Join(destDir, name)
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if header.Size > maxEntrySize {
+				return fmt.Errorf("bundle entry %q is too large (%d bytes)", header.Name, header.Size)
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			data, err := io.ReadAll(io.LimitReader(tr, maxEntrySize))
+			if err != nil {
+				return fmt.Errorf("failed to read bundle entry %q: %w", header.Name, err)
+			}
+			if err := os.WriteFile(target, data, 0644); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("bundle entry %q has unsupported type %c", header.Name, header.Typeflag)
+		}
+	}
+}
+
+// Verify 校验规则目录中的文件与 checksums.sha256 一致
+//
+// trustedKey 不为空时同时校验签名，没有签名时返回 ErrUnsigned。
+func Verify(dir string, trustedKey ed25519.PublicKey) error {
+	checksums, err := os.ReadFile(filepath.Join(dir, ChecksumsFile))
+	if err != nil {
+		return fmt.Errorf("failed to read checksums: %w", err)
+	}
+
+	expected, err := parseChecksums(checksums)
+	if err != nil {
+		return err
+	}
+	if _, ok := expected[WasmFile]; !ok {
+		return fmt.Errorf("checksums do not cover %s", WasmFile)
+	}
+	if _, ok := expected[ManifestFile]; !ok {
+		return fmt.Errorf("checksums do not cover %s", ManifestFile)
+	}
+
+	actual := make(map[string]string)
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == ChecksumsFile || rel == SignatureFile {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		actual[rel] = sha256Hex(data)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to hash bundle files: %w", err)
+	}
+
+	for name, sum := range expected {
+		got, ok := actual[name]
+		if !ok {
+			return fmt.Errorf("file %s is missing", name)
+		}
+		if got != sum {
+			return fmt.Errorf("checksum mismatch for %s", name)
+		}
+	}
+	for name := range actual {
+		if _, ok := expected[name]; !ok {
+			return fmt.Errorf("file %s is not covered by checksums", name)
+		}
+	}
+
+	if trustedKey == nil {
+		return nil
+	}
+
+	signature, err := os.ReadFile(filepath.Join(dir, SignatureFile))
+	if os.IsNotExist(err) {
+		return ErrUnsigned
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read signature: %w", err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %w", err)
+	}
+	if !ed25519.Verify(trustedKey, checksums, sig) {
+		return errors.New("signature verification failed")
+	}
+
+	return nil
+}
+
+// WriteChecksums 为规则目录生成 checksums.sha256，用于安装未打包的规则目录
+func WriteChecksums(dir string) error {
+	contents := make(map[string][]byte)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == ChecksumsFile || rel == SignatureFile {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		contents[rel] = data
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, ChecksumsFile), formatChecksums(contents), 0644)
+}
+
+// GenerateKey 生成签名密钥对，以 base64 编码返回
+func GenerateKey() (public, private string, err error) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(pub), base64.StdEncoding.EncodeToString(priv), nil
+}
+
+// ReadPrivateKey 读取 base64 编码的签名私钥
+func ReadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	key, err := readKey(path, ed25519.PrivateKeySize)
+	if err != nil {
+		return nil, err
+	}
+	return ed25519.PrivateKey(key), nil
+}
+
+// ReadPublicKey 读取 base64 编码的验签公钥
+func ReadPublicKey(path string) (ed25519.PublicKey, error) {
+	key, err := readKey(path, ed25519.PublicKeySize)
+	if err != nil {
+		return nil, err
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// readKey 读取并校验密钥长度
+func readKey(path string, size int) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key %s: %w", path, err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid key encoding in %s: %w", path, err)
+	}
+	if len(key) != size {
+		return nil, fmt.Errorf("invalid key length in %s: got %d bytes, want %d", path, len(key), size)
+	}
+	return key, nil
+}
+
+// readBundleManifest 读取清单，规则包要求清单包含名称和版本
+func readBundleManifest(path string) (*engine.RuleManifest, error) {
+	manifest, err := engine.ReadManifest(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkName(manifest.Name); err != nil {
+		return nil, fmt.Errorf("manifest %s: %w", path, err)
+	}
+	if err := checkVersion(manifest.Version); err != nil {
+		return nil, fmt.Errorf("manifest %s: %w", path, err)
+	}
+	return manifest, nil
+}
+
+// checkName 校验规则名称，名称用作目录名，不能包含路径分隔符或以 . 开头（包括 . 和 ..）
+func checkName(name string) error {
+	if name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("invalid rule name %q", name)
+	}
+	return nil
+}
+
+// checkVersion 校验版本号，版本号必须是语义化版本（例如 1.2.0），
+// 因此不会包含路径分隔符，也不会与版本目录中的 history 等文件重名
+func checkVersion(version string) error {
+	if version == "" {
+		return fmt.Errorf("version is required")
+	}
+	_, err := parseVersion(version)
+	return err
+}
+
+// FindWasm 查找目录下唯一的 .wasm 文件
+func FindWasm(dir string) (string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.wasm"))
+	if err != nil {
+		return "", err
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no .wasm file found in %s", dir)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("multiple .wasm files found in %s, specify one explicitly", dir)
+	}
+}
+
+// writeArchive 按文件名顺序写入 tar.gz
+func writeArchive(outPath string, contents map[string][]byte) error {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	names := make([]string, 0, len(contents))
+	for name := range contents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		data := contents[name]
+		header := &tar.Header{
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(data)),
+			Typeflag: tar.TypeReg,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(outPath, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write bundle %s: %w", outPath, err)
+	}
+
+	return nil
+}
+
+// formatChecksums 生成 sha256sum 格式的校验和文件
+func formatChecksums(contents map[string][]byte) []byte {
+	names := make([]string, 0, len(contents))
+	for name := range contents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&buf, "%s  %s\n", sha256Hex(contents[name]), name)
+	}
+	return buf.Bytes()
+}
+
+// parseChecksums 解析 sha256sum 格式的校验和文件
+func parseChecksums(data []byte) (map[string]string, error) {
+	sums := make(map[string]string)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		sum, name, ok := strings.Cut(line, "  ")
+		if !ok || len(sum) != sha256.Size*2 {
+			return nil, fmt.Errorf("invalid checksum line: %q", line)
+		}
+		sums[name] = sum
+	}
+
+	return sums, scanner.Err()
+}
+
+// sha256Hex 计算 SHA-256 摘要
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,401 @@
+package bundle
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/wasm-threat-detector/host/internal/engine"
+)
+
+// versionsDir 存放所有已安装版本的隐藏目录，引擎加载规则时会跳过
+const versionsDir = ".versions"
+
+// historyFile 记录版本激活顺序，最后一行为当前版本
+const historyFile = "history"
+
+// InstalledRule 已安装的规则
+type InstalledRule struct {
+	Name     string
+	Active   string   // 当前激活的版本
+	Versions []string // 已安装的所有版本，按语义化版本从低到高排列
+	Verified error    // 当前激活版本的完整性校验结果
+}
+
+// Store 已安装规则目录
+//
+// 目录结构：
+//
+//	<root>/<name>/                        当前激活版本的副本，引擎直接从这里加载
+//	<root>/.versions/<name>/<version>/    已安装的各个版本
+//	<root>/.versions/<name>/history       版本激活顺序
+type Store struct {
+	root       string
+	trustedKey ed25519.PublicKey
+}
+
+// NewStore 创建规则目录，trustedKey 不为空时只安装签名有效的规则包
+func NewStore(root string, trustedKey ed25519.PublicKey) *Store {
+	return &Store{
+		root:       root,
+		trustedKey: trustedKey,
+	}
+}
+
+// Install 安装规则包或规则目录，并激活该版本
+func (s *Store) Install(src string) (*InstalledRule, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %w", src, err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(s.root, versionsDir), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create rules directory: %w", err)
+	}
+
+	staging, err := os.MkdirTemp(filepath.Join(s.root, versionsDir), ".staging-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	switch {
+	case !info.IsDir():
+		err = Extract(src, staging)
+	case fileExists(filepath.Join(src, ChecksumsFile)):
+		// 已解压的规则包
+		err = copyDir(src, staging)
+	default:
+		// 规则源目录，先打包再解压以得到规范的目录结构
+		bundlePath := filepath.Join(staging, ".bundle.tar.gz")
+		if _, err = Pack(src, "", bundlePath, nil); err == nil {
+			err = Extract(bundlePath, staging)
+			os.Remove(bundlePath)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := Verify(staging, s.trustedKey); err != nil {
+		return nil, fmt.Errorf("integrity check failed for %s: %w", src, err)
+	}
+
+	manifest, err := readBundleManifest(filepath.Join(staging, ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+
+	// 安装前校验模块，避免激活无法加载的版本
+	moduleInfo, err := engine.Inspect(filepath.Join(staging, WasmFile))
+	if err != nil {
+		return nil, err
+	}
+	if err := moduleInfo.Validate(manifest.RuleKind()); err != nil {
+		return nil, err
+	}
+	if _, err := manifest.EventSchemaVersion(); err != nil {
+		return nil, err
+	}
+
+	versionPath := s.versionPath(manifest.Name, manifest.Version)
+	if err := os.MkdirAll(filepath.Dir(versionPath), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.RemoveAll(versionPath); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(staging, versionPath); err != nil {
+		return nil, fmt.Errorf("failed to store %s %s: %w", manifest.Name, manifest.Version, err)
+	}
+
+	if err := s.activate(manifest.Name, manifest.Version); err != nil {
+		return nil, err
+	}
+
+	history, err := s.readHistory(manifest.Name)
+	if err != nil {
+		return nil, err
+	}
+	history = append(removeVersion(history, manifest.Version), manifest.Version)
+	if err := s.writeHistory(manifest.Name, history); err != nil {
+		return nil, err
+	}
+
+	return s.Get(manifest.Name)
+}
+
+// Rollback 回滚到上一个激活的版本
+func (s *Store) Rollback(name string) (*InstalledRule, error) {
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+	history, err := s.readHistory(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(history) < 2 {
+		return nil, fmt.Errorf("rule %s has no previous version to roll back to", name)
+	}
+
+	history = history[:len(history)-1]
+	if err := s.activate(name, history[len(history)-1]); err != nil {
+		return nil, err
+	}
+	if err := s.writeHistory(name, history); err != nil {
+		return nil, err
+	}
+
+	return s.Get(name)
+}
+
+// Remove 删除规则的指定版本，version 为空时删除规则的所有版本
+//
+// 删除当前激活的版本时会激活上一个版本，没有上一个版本时激活剩余的最新版本。
+func (s *Store) Remove(name, version string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	if !fileExists(filepath.Join(s.root, versionsDir, name)) {
+		return fmt.Errorf("rule %s is not installed", name)
+	}
+	if version != "" {
+		if err := s.checkInstalledVersion(name, version); err != nil {
+			return err
+		}
+	}
+
+	if version == "" {
+		if err := os.RemoveAll(filepath.Join(s.root, name)); err != nil {
+			return err
+		}
+		return os.RemoveAll(filepath.Join(s.root, versionsDir, name))
+	}
+
+	if !fileExists(s.versionPath(name, version)) {
+		return fmt.Errorf("rule %s version %s is not installed", name, version)
+	}
+
+	history, err := s.readHistory(name)
+	if err != nil {
+		return err
+	}
+	wasActive := len(history) > 0 && history[len(history)-1] == version
+	history = removeVersion(history, version)
+
+	if err := os.RemoveAll(s.versionPath(name, version)); err != nil {
+		return err
+	}
+
+	if wasActive {
+		// 激活历史为空时使用剩余的最新版本
+		if len(history) == 0 {
+			rule, err := s.Get(name)
+			if err != nil {
+				return err
+			}
+			if len(rule.Versions) == 0 {
+				return s.Remove(name, "")
+			}
+			history = rule.Versions[len(rule.Versions)-1:]
+		}
+		if err := s.activate(name, history[len(history)-1]); err != nil {
+			return err
+		}
+	}
+
+	return s.writeHistory(name, history)
+}
+
+// List 列出所有已安装的规则
+func (s *Store) List() ([]*InstalledRule, error) {
+	entries, err := os.ReadDir(filepath.Join(s.root, versionsDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []*InstalledRule
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		rule, err := s.Get(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// Get 获取已安装规则的状态
+func (s *Store) Get(name string) (*InstalledRule, error) {
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(filepath.Join(s.root, versionsDir, name))
+	if err != nil {
+		return nil, fmt.Errorf("rule %s is not installed", name)
+	}
+
+	rule := &InstalledRule{Name: name}
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			rule.Versions = append(rule.Versions, entry.Name())
+		}
+	}
+	sort.Slice(rule.Versions, func(i, j int) bool {
+		return compareVersions(rule.Versions[i], rule.Versions[j]) < 0
+	})
+
+	history, err := s.readHistory(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(history) > 0 {
+		rule.Active = history[len(history)-1]
+	}
+	rule.Verified = Verify(filepath.Join(s.root, name), s.trustedKey)
+
+	return rule, nil
+}
+
+// activate 用指定版本替换当前激活的规则目录
+func (s *Store) activate(name, version string) error {
+	activePath := filepath.Join(s.root, name)
+	tmpPath := filepath.Join(s.root, versionsDir, name, ".activating")
+
+	if err := os.RemoveAll(tmpPath); err != nil {
+		return err
+	}
+	if err := copyDir(s.versionPath(name, version), tmpPath); err != nil {
+		return fmt.Errorf("failed to activate %s %s: %w", name, version, err)
+	}
+	if err := os.RemoveAll(activePath); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, activePath); err != nil {
+		return fmt.Errorf("failed to activate %s %s: %w", name, version, err)
+	}
+
+	return nil
+}
+
+// checkInstalledVersion 校验要删除的版本号：语义化版本，或者已安装的版本目录
+// （之前的版本允许非语义化版本号，需要能删除）
+func (s *Store) checkInstalledVersion(name, version string) error {
+	err := checkVersion(version)
+	if err == nil {
+		return nil
+	}
+	rule, getErr := s.Get(name)
+	if getErr != nil {
+		return getErr
+	}
+	for _, v := range rule.Versions {
+		if v == version {
+			return nil
+		}
+	}
+	return err
+}
+
+// versionPath 返回已安装版本的目录
+func (s *Store) versionPath(name, version string) string {
+	return filepath.Join(s.root, versionsDir, name, version)
+}
+
+// readHistory 读取版本激活顺序
+func (s *Store) readHistory(name string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(s.root, versionsDir, name, historyFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var history []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if version := strings.TrimSpace(scanner.Text()); version != "" {
+			history = append(history, version)
+		}
+	}
+
+	return history, scanner.Err()
+}
+
+// writeHistory 写入版本激活顺序
+func (s *Store) writeHistory(name string, history []string) error {
+	var buf bytes.Buffer
+	for _, version := range history {
+		buf.WriteString(version)
+		buf.WriteByte('\n')
+	}
+	return os.WriteFile(filepath.Join(s.root, versionsDir, name, historyFile), buf.Bytes(), 0644)
+}
+
+// removeVersion 从激活历史中删除指定版本
+func removeVersion(history []string, version string) []string {
+	result := history[:0]
+	for _, v := range history {
+		if v != version {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// copyDir 递归复制目录
+func copyDir(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+}
+
+// fileExists 判断路径是否存在
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
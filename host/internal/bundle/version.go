@@ -0,0 +1,168 @@
+package bundle
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// semver 语义化版本 MAJOR.MINOR.PATCH[-PRERELEASE][+BUILD]
+type semver struct {
+	core       [3]uint64
+	prerelease []string
+}
+
+// parseVersion 解析语义化版本，不允许前导 v 和数字的前导零
+func parseVersion(version string) (semver, error) {
+	var v semver
+
+	rest, build, hasBuild := strings.Cut(version, "+")
+	rest, prerelease, hasPrerelease := strings.Cut(rest, "-")
+
+	parts := strings.Split(rest, ".")
+	if len(parts) != 3 {
+		return v, fmt.Errorf("invalid version %q: expected MAJOR.MINOR.PATCH", version)
+	}
+	for i, part := range parts {
+		n, err := parseNumeric(part)
+		if err != nil {
+			return v, fmt.Errorf("invalid version %q: %w", version, err)
+		}
+		v.core[i] = n
+	}
+
+	if hasPrerelease {
+		v.prerelease = strings.Split(prerelease, ".")
+		for _, id := range v.prerelease {
+			if !validIdentifier(id) {
+				return v, fmt.Errorf("invalid version %q: invalid pre-release identifier %q", version, id)
+			}
+			if isNumeric(id) {
+				if _, err := parseNumeric(id); err != nil {
+					return v, fmt.Errorf("invalid version %q: %w", version, err)
+				}
+			}
+		}
+	}
+	if hasBuild {
+		for _, id := range strings.Split(build, ".") {
+			if !validIdentifier(id) {
+				return v, fmt.Errorf("invalid version %q: invalid build identifier %q", version, id)
+			}
+		}
+	}
+
+	return v, nil
+}
+
+// parseNumeric 解析版本中的数字，不允许前导零
+func parseNumeric(s string) (uint64, error) {
+	if !isNumeric(s) {
+		return 0, fmt.Errorf("%q is not a number", s)
+	}
+	if len(s) > 1 && s[0] == '0' {
+		return 0, fmt.Errorf("%q has a leading zero", s)
+	}
+	return strconv.ParseUint(s, 10, 64)
+}
+
+// isNumeric 判断标识符是否只包含数字
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// validIdentifier 判断先行版本或构建标识符是否只包含字母、数字和连字符
+func validIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// compare 按语义化版本的优先级比较，构建信息不参与比较
+func (v semver) compare(other semver) int {
+	for i := range v.core {
+		if v.core[i] != other.core[i] {
+			if v.core[i] < other.core[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	// 先行版本低于正式版本
+	switch {
+	case len(v.prerelease) == 0 && len(other.prerelease) == 0:
+		return 0
+	case len(v.prerelease) == 0:
+		return 1
+	case len(other.prerelease) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(v.prerelease) && i < len(other.prerelease); i++ {
+		if c := compareIdentifier(v.prerelease[i], other.prerelease[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(v.prerelease) < len(other.prerelease):
+		return -1
+	case len(v.prerelease) > len(other.prerelease):
+		return 1
+	}
+	return 0
+}
+
+// compareIdentifier 比较先行版本标识符：数字按数值比较且低于非数字标识符，其余按 ASCII 比较
+func compareIdentifier(a, b string) int {
+	aNum, bNum := isNumeric(a), isNumeric(b)
+	switch {
+	case aNum && bNum:
+		x, _ := strconv.ParseUint(a, 10, 64)
+		y, _ := strconv.ParseUint(b, 10, 64)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	case aNum:
+		return -1
+	case bNum:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// compareVersions 比较两个已安装的版本，无法解析的版本（旧版本安装的）排在前面并按字符串比较
+func compareVersions(a, b string) int {
+	va, errA := parseVersion(a)
+	vb, errB := parseVersion(b)
+	switch {
+	case errA != nil && errB != nil:
+		return strings.Compare(a, b)
+	case errA != nil:
+		return -1
+	case errB != nil:
+		return 1
+	}
+	if c := va.compare(vb); c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
+}
@@ -1,17 +1,15 @@
 package collector
 
 import (
-	"bufio"
 	"context"
 	"fmt"
-	"os"
-	"os/exec"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/wasm-threat-detector/host/internal/events"
+	"github.com/wasm-threat-detector/host/internal/procfs"
 )
 
 // Collector 事件收集器接口
@@ -21,27 +19,58 @@ type Collector interface {
 	EventChannel() <-chan *events.Event
 }
 
+// Scanner 可以对当前状态执行一次扫描的收集器，用于离线分析快照，不需要调用 Start
+type Scanner interface {
+	Collector
+	// ScanOnce 扫描一次，事件发送到事件通道
+	ScanOnce() error
+}
+
+// DefaultAncestryDepth 进程事件中默认附加的祖先层数
+const DefaultAncestryDepth = 5
+
 // ProcessCollector 进程事件收集器
 type ProcessCollector struct {
 	logger    *logrus.Logger
+	proc      *procfs.FS
+	table     *procfs.Table
+	config    ProcessConfig
 	eventChan chan *events.Event
 	done      chan struct{}
 }
 
-// NewProcessCollector 创建新的进程收集器
-func NewProcessCollector(logger *logrus.Logger) *ProcessCollector {
+// NewProcessCollector 创建新的进程收集器，进程信息从 proc 读取
+func NewProcessCollector(logger *logrus.Logger, proc *procfs.FS, config ProcessConfig) *ProcessCollector {
 	return &ProcessCollector{
 		logger:    logger,
+		proc:      proc,
+		table:     procfs.NewTable(proc),
+		config:    config,
 		eventChan: make(chan *events.Event, 1000),
 		done:      make(chan struct{}),
 	}
 }
 
 // Start 启动进程监控
+//
+// 优先使用 netlink 进程连接器实时接收 exec/fork/exit 事件；
+// 没有 CAP_NET_ADMIN 或不是 Linux 时回退到按 scan_interval 轮询进程列表，轮询会漏掉短命进程，
+// 上报的退出时间精确到轮询周期，且没有退出码。
 func (pc *ProcessCollector) Start(ctx context.Context) error {
 	pc.logger.Info("Starting process collector")
 
-	go pc.monitorProcesses(ctx)
+	// 记录已经在运行的进程，以便它们退出时能计算运行时长
+	if err := pc.table.Scan(); err != nil {
+		pc.logger.Warnf("Failed to scan processes: %v", err)
+	}
+
+	if conn, err := openProcConnector(); err == nil {
+		pc.logger.Info("Using netlink process connector for process events")
+		go pc.monitorProcConnector(ctx, conn)
+	} else {
+		pc.logger.Warnf("Netlink process connector unavailable, falling back to polling: %v", err)
+		go pc.monitorProcesses(ctx)
+	}
 	go pc.monitorSystemCalls(ctx)
 
 	return nil
@@ -60,12 +89,21 @@ func (pc *ProcessCollector) EventChannel() <-chan *events.Event {
 	return pc.eventChan
 }
 
-// monitorProcesses 监控进程创建/退出
+// send 发送事件，通道满时丢弃
+func (pc *ProcessCollector) send(event *events.Event) {
+	select {
+	case pc.eventChan <- event:
+	default:
+		pc.logger.Warn("Event channel full, dropping process event")
+	}
+}
+
+// monitorProcesses 轮询进程列表，监控进程创建和退出
 func (pc *ProcessCollector) monitorProcesses(ctx context.Context) {
-	ticker := time.NewTicker(1 * time.Second)
+	ticker := time.NewTicker(pc.config.ScanInterval)
 	defer ticker.Stop()
 
-	lastProcesses := make(map[int32]bool)
+	lastProcesses := make(map[int32]uint64)
 
 	for {
 		select {
@@ -74,35 +112,79 @@ func (pc *ProcessCollector) monitorProcesses(ctx context.Context) {
 		case <-pc.done:
 			return
 		case <-ticker.C:
-			currentProcesses := pc.getCurrentProcesses()
-
-			// 检测新进程
-			for pid := range currentProcesses {
-				if !lastProcesses[pid] {
-					if proc := pc.getProcessInfo(pid); proc != nil {
-						event := &events.Event{
-							ID:        fmt.Sprintf("proc_%d_%d", pid, time.Now().Unix()),
-							Type:      events.EventTypeProcess,
-							Timestamp: time.Now(),
-							Source:    "process_collector",
-							Data: map[string]interface{}{
-								"action":  "create",
-								"process": proc,
-							},
-						}
-
-						select {
-						case pc.eventChan <- event:
-						default:
-							pc.logger.Warn("Event channel full, dropping process event")
-						}
-					}
-				}
+			current, err := pc.scanProcesses(lastProcesses)
+			if err != nil {
+				pc.logger.Warnf("Failed to get process list: %v", err)
+				continue
 			}
+			lastProcesses = current
+		}
+	}
+}
+
+// ScanOnce 扫描一次进程列表，上报所有进程的 create 事件和可疑进程，用于离线分析快照
+func (pc *ProcessCollector) ScanOnce() error {
+	if _, err := pc.scanProcesses(nil); err != nil {
+		return fmt.Errorf("failed to get process list: %w", err)
+	}
+	pc.checkSuspiciousProcesses()
+	return nil
+}
+
+// scanProcesses 扫描进程表，与上次扫描的进程（PID -> 启动时间）比较，上报新建和退出的进程
+func (pc *ProcessCollector) scanProcesses(lastProcesses map[int32]uint64) (map[int32]uint64, error) {
+	if err := pc.table.Scan(); err != nil {
+		return nil, err
+	}
 
-			lastProcesses = currentProcesses
+	// 检测新进程，PID 相同但启动时间不同的视为新进程（PID 复用）
+	currentProcesses := make(map[int32]uint64)
+	for _, proc := range pc.table.Processes() {
+		currentProcesses[proc.PID] = proc.StartTime
+		if startTime, ok := lastProcesses[proc.PID]; ok && startTime == proc.StartTime {
+			continue
+		}
+
+		pc.send(&events.Event{
+			SchemaVersion: events.CurrentSchemaVersion,
+			ID:            fmt.Sprintf("proc_%d_%d", proc.PID, time.Now().Unix()),
+			Type:          events.EventTypeProcess,
+			Timestamp:     time.Now(),
+			Source:        "process_collector",
+			Data: map[string]interface{}{
+				"action":  "create",
+				"process": pc.describe(proc),
+			},
+		})
+	}
+
+	// 检测退出的进程，进程表在扫描时已记录退出时间
+	for pid, startTime := range lastProcesses {
+		if current, ok := currentProcesses[pid]; ok && current == startTime {
+			continue
+		}
+		// 同一 PID 在两次扫描之间被复用后又退出时只能查到最后一个进程，这里忽略
+		exited, ok := pc.table.Exited(pid)
+		if !ok || exited.StartTime != startTime {
+			continue
+		}
+
+		data := map[string]interface{}{
+			"action":  "exit",
+			"process": pc.describe(exited),
 		}
+		addLifetime(data, exited)
+		pc.send(&events.Event{
+			SchemaVersion: events.CurrentSchemaVersion,
+			ID:            fmt.Sprintf("proc_exit_%d_%d", pid, time.Now().UnixNano()),
+			Type:          events.EventTypeProcess,
+			Timestamp:     time.Now(),
+			Source:        "process_collector",
+			Data:          data,
+		})
 	}
+
+	return currentProcesses, nil
 }
 
 // monitorSystemCalls 监控系统调用（简化版，实际应使用 eBPF）
@@ -110,7 +192,7 @@ func (pc *ProcessCollector) monitorSystemCalls(ctx context.Context) {
 	// 这里是一个简化的实现，实际生产环境应该使用 eBPF
 	// 监控可疑的系统调用模式
 
-	ticker := time.NewTicker(5 * time.Second)
+	ticker := time.NewTicker(pc.config.SuspiciousCheckInterval)
 	defer ticker.Stop()
 
 	for {
@@ -126,117 +208,50 @@ func (pc *ProcessCollector) monitorSystemCalls(ctx context.Context) {
 	}
 }
 
-// getCurrentProcesses 获取当前所有进程
-func (pc *ProcessCollector) getCurrentProcesses() map[int32]bool {
-	processes := make(map[int32]bool)
-
-	cmd := exec.Command("ps", "-eo", "pid")
-	output, err := cmd.Output()
-	if err != nil {
-		pc.logger.Warnf("Failed to get process list: %v", err)
-		return processes
+// describe 将进程信息转换为事件中的进程信息，并附加祖先链
+func (pc *ProcessCollector) describe(proc *procfs.Process) *events.ProcessInfo {
+	info := processInfo(proc)
+	if pc.config.AncestryDepth <= 0 {
+		return info
 	}
 
-	scanner := bufio.NewScanner(strings.NewReader(string(output)))
-	scanner.Scan() // 跳过标题行
-
-	for scanner.Scan() {
-		pidStr := strings.TrimSpace(scanner.Text())
-		if pid, err := strconv.ParseInt(pidStr, 10, 32); err == nil {
-			processes[int32(pid)] = true
-		}
+	for _, ancestor := range pc.table.Ancestors(proc, pc.config.AncestryDepth) {
+		info.Ancestors = append(info.Ancestors, events.ProcessAncestor{
+			PID:         ancestor.PID,
+			Name:        ancestor.Name,
+			Executable:  ancestor.Executable,
+			CommandLine: ancestor.CommandLine,
+			User:        strconv.FormatUint(uint64(ancestor.UID), 10),
+			Exited:      ancestor.Exited(),
+		})
 	}
 
-	return processes
+	return info
 }
 
-// getProcessInfo 获取进程详细信息
-func (pc *ProcessCollector) getProcessInfo(pid int32) *events.ProcessInfo {
-	// 读取 /proc/{pid}/stat 获取进程信息
-	statPath := fmt.Sprintf("/proc/%d/stat", pid)
-	statData, err := os.ReadFile(statPath)
-	if err != nil {
-		return nil
-	}
-
-	fields := strings.Fields(string(statData))
-	if len(fields) < 4 {
-		return nil
-	}
-
-	// 获取可执行文件路径
-	exePath := fmt.Sprintf("/proc/%d/exe", pid)
-	executable, _ := os.Readlink(exePath)
-
-	// 获取命令行
-	cmdlinePath := fmt.Sprintf("/proc/%d/cmdline", pid)
-	cmdlineData, err := os.ReadFile(cmdlinePath)
-	var commandLine string
-	if err == nil {
-		commandLine = strings.ReplaceAll(string(cmdlineData), "\x00", " ")
-		commandLine = strings.TrimSpace(commandLine)
-	}
-
-	// 解析 PPID
-	ppid, _ := strconv.ParseInt(fields[3], 10, 32)
-
-	// 获取进程名（从 stat 文件中提取）
-	name := fields[1]
-	if len(name) > 2 && name[0] == '(' && name[len(name)-1] == ')' {
-		name = name[1 : len(name)-1]
-	}
-
+// processInfo 将 /proc 中读取的进程信息转换为事件中的进程信息
+func processInfo(proc *procfs.Process) *events.ProcessInfo {
 	return &events.ProcessInfo{
-		PID:         pid,
-		PPID:        int32(ppid),
-		Name:        name,
-		Executable:  executable,
-		CommandLine: commandLine,
-		User:        pc.getProcessUser(pid),
-		Group:       pc.getProcessGroup(pid),
-	}
-}
-
-// getProcessUser 获取进程用户
-func (pc *ProcessCollector) getProcessUser(pid int32) string {
-	statusPath := fmt.Sprintf("/proc/%d/status", pid)
-	statusData, err := os.ReadFile(statusPath)
-	if err != nil {
-		return "unknown"
-	}
-
-	lines := strings.Split(string(statusData), "\n")
-	for _, line := range lines {
-		if strings.HasPrefix(line, "Uid:") {
-			fields := strings.Fields(line)
-			if len(fields) > 1 {
-				return fields[1] // 返回 real UID
-			}
-		}
+		PID:         proc.PID,
+		PPID:        proc.PPID,
+		Name:        proc.Name,
+		Executable:  proc.Executable,
+		CommandLine: proc.CommandLine,
+		User:        strconv.FormatUint(uint64(proc.UID), 10),
+		Group:       strconv.FormatUint(uint64(proc.GID), 10),
 	}
-
-	return "unknown"
 }
 
-// getProcessGroup 获取进程组
-func (pc *ProcessCollector) getProcessGroup(pid int32) string {
-	statusPath := fmt.Sprintf("/proc/%d/status", pid)
-	statusData, err := os.ReadFile(statusPath)
-	if err != nil {
-		return "unknown"
+// addLifetime 在退出事件中加入进程的启动时间、退出时间、运行时长和退出码
+func addLifetime(data map[string]interface{}, proc *procfs.Process) {
+	if !proc.StartedAt.IsZero() {
+		data["start_time"] = proc.StartedAt
+		data["duration_ms"] = proc.Lifetime(proc.ExitedAt).Milliseconds()
 	}
-
-	lines := strings.Split(string(statusData), "\n")
-	for _, line := range lines {
-		if strings.HasPrefix(line, "Gid:") {
-			fields := strings.Fields(line)
-			if len(fields) > 1 {
-				return fields[1] // 返回 real GID
-			}
-		}
+	data["exit_time"] = proc.ExitedAt
+	if proc.ExitCode >= 0 {
+		data["exit_code"] = proc.ExitCode
 	}
-
-	return "unknown"
 }
 
 // checkSuspiciousProcesses 检查可疑进程活动
@@ -257,251 +272,36 @@ func (pc *ProcessCollector) checkSuspiciousProcesses() {
 		"curl",
 	}
 
-	cmd := exec.Command("ps", "-eo", "pid,comm,args")
-	output, err := cmd.Output()
-	if err != nil {
+	// 轮询模式下进程表按 scan_interval 更新，这里直接复用；使用进程连接器时按需扫描
+	if err := pc.table.ScanIfStale(pc.config.ScanInterval); err != nil {
 		pc.logger.Warnf("Failed to get process list for suspicious check: %v", err)
 		return
 	}
 
-	scanner := bufio.NewScanner(strings.NewReader(string(output)))
-	scanner.Scan() // 跳过标题行
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		fields := strings.Fields(line)
-		if len(fields) < 3 {
+	self := pc.proc.Self()
+	for _, proc := range pc.table.Processes() {
+		if proc.PID == self {
 			continue
 		}
 
-		pidStr := fields[0]
-		pid, err := strconv.ParseInt(pidStr, 10, 32)
-		if err != nil {
-			continue
-		}
-
-		comm := fields[1]
-		args := strings.Join(fields[2:], " ")
-
 		// 检查是否匹配可疑模式
 		for _, pattern := range suspiciousPatterns {
-			if strings.Contains(comm, pattern) || strings.Contains(args, pattern) {
-				if proc := pc.getProcessInfo(int32(pid)); proc != nil {
-					event := &events.Event{
-						ID:        fmt.Sprintf("suspicious_%d_%d", pid, time.Now().Unix()),
-						Type:      events.EventTypeProcess,
-						Timestamp: time.Now(),
-						Source:    "process_collector",
-						Data: map[string]interface{}{
-							"action":     "suspicious_activity",
-							"pattern":    pattern,
-							"process":    proc,
-							"risk_level": "medium",
-						},
-					}
-
-					select {
-					case pc.eventChan <- event:
-					default:
-						pc.logger.Warn("Event channel full, dropping suspicious process event")
-					}
-				}
-				break
-			}
-		}
-	}
-}
-
-// NetworkCollector 网络事件收集器（简化版）
-type NetworkCollector struct {
-	logger    *logrus.Logger
-	eventChan chan *events.Event
-	done      chan struct{}
-}
-
-// NewNetworkCollector 创建网络收集器
-func NewNetworkCollector(logger *logrus.Logger) *NetworkCollector {
-	return &NetworkCollector{
-		logger:    logger,
-		eventChan: make(chan *events.Event, 1000),
-		done:      make(chan struct{}),
-	}
-}
-
-// Start 启动网络监控
-func (nc *NetworkCollector) Start(ctx context.Context) error {
-	nc.logger.Info("Starting network collector")
-
-	go nc.monitorConnections(ctx)
-
-	return nil
-}
-
-// Stop 停止收集器
-func (nc *NetworkCollector) Stop() error {
-	nc.logger.Info("Stopping network collector")
-	close(nc.done)
-	close(nc.eventChan)
-	return nil
-}
-
-// EventChannel 返回事件通道
-func (nc *NetworkCollector) EventChannel() <-chan *events.Event {
-	return nc.eventChan
-}
-
-// monitorConnections 监控网络连接
-func (nc *NetworkCollector) monitorConnections(ctx context.Context) {
-	ticker := time.NewTicker(10 * time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-nc.done:
-			return
-		case <-ticker.C:
-			nc.checkNetworkConnections()
-		}
-	}
-}
-
-// checkNetworkConnections 检查网络连接
-func (nc *NetworkCollector) checkNetworkConnections() {
-	// 读取 /proc/net/tcp 和 /proc/net/tcp6
-	for _, protocol := range []string{"tcp", "tcp6"} {
-		path := fmt.Sprintf("/proc/net/%s", protocol)
-		nc.parseNetworkFile(path, protocol)
-	}
-}
-
-// parseNetworkFile 解析网络文件
-func (nc *NetworkCollector) parseNetworkFile(path, protocol string) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return
-	}
-
-	lines := strings.Split(string(data), "\n")
-	for i, line := range lines {
-		if i == 0 || strings.TrimSpace(line) == "" {
-			continue // 跳过标题行和空行
-		}
-
-		fields := strings.Fields(line)
-		if len(fields) < 10 {
-			continue
-		}
-
-		// 解析本地和远程地址
-		localAddr := fields[1]
-		remoteAddr := fields[2]
-		state := fields[3]
-
-		// 只关注已建立的连接
-		if state != "01" { // 01 表示 ESTABLISHED
-			continue
-		}
-
-		localIP, localPort := nc.parseAddress(localAddr)
-		remoteIP, remotePort := nc.parseAddress(remoteAddr)
-
-		// 检查是否为可疑连接
-		if nc.isSuspiciousConnection(remoteIP, remotePort) {
-			event := &events.Event{
-				ID:        fmt.Sprintf("net_%s_%d", remoteAddr, time.Now().Unix()),
-				Type:      events.EventTypeNetwork,
-				Timestamp: time.Now(),
-				Source:    "network_collector",
-				Data: map[string]interface{}{
-					"network": events.NetworkInfo{
-						Protocol:   protocol,
-						SourceIP:   localIP,
-						SourcePort: localPort,
-						DestIP:     remoteIP,
-						DestPort:   remotePort,
-						Direction:  "outbound",
+			if strings.Contains(proc.Name, pattern) || strings.Contains(proc.CommandLine, pattern) {
+				pc.send(&events.Event{
+					SchemaVersion: events.CurrentSchemaVersion,
+					ID:            fmt.Sprintf("suspicious_%d_%d", proc.PID, time.Now().Unix()),
+					Type:          events.EventTypeProcess,
+					Timestamp:     time.Now(),
+					Source:        "process_collector",
+					Data: map[string]interface{}{
+						"action":     "suspicious_activity",
+						"pattern":    pattern,
+						"process":    pc.describe(proc),
+						"risk_level": "medium",
 					},
-					"risk_level": "high",
-				},
-			}
-
-			select {
-			case nc.eventChan <- event:
-			default:
-				nc.logger.Warn("Event channel full, dropping network event")
+				})
+				break
 			}
 		}
 	}
 }
-
-// parseAddress 解析地址字符串
-func (nc *NetworkCollector) parseAddress(addr string) (string, int) {
-	parts := strings.Split(addr, ":")
-	if len(parts) != 2 {
-		return "", 0
-	}
-
-	// 解析 IP 地址（十六进制格式）
-	ipHex := parts[0]
-	portHex := parts[1]
-
-	var ip string
-	if len(ipHex) == 8 { // IPv4
-		ip = nc.parseIPv4(ipHex)
-	} else { // IPv6
-		ip = nc.parseIPv6(ipHex)
-	}
-
-	port, _ := strconv.ParseInt(portHex, 16, 32)
-
-	return ip, int(port)
-}
-
-// parseIPv4 解析 IPv4 地址
-func (nc *NetworkCollector) parseIPv4(hex string) string {
-	if len(hex) != 8 {
-		return ""
-	}
-
-	var parts []string
-	for i := 6; i >= 0; i -= 2 {
-		part, _ := strconv.ParseInt(hex[i:i+2], 16, 32)
-		parts = append(parts, strconv.Itoa(int(part)))
-	}
-
-	return strings.Join(parts, ".")
-}
-
-// parseIPv6 解析 IPv6 地址（简化版）
-func (nc *NetworkCollector) parseIPv6(hex string) string {
-	// 这里简化处理，实际应该正确解析 IPv6
-	return fmt.Sprintf("IPv6:%s", hex)
-}
-
-// isSuspiciousConnection 检查是否为可疑连接
-func (nc *NetworkCollector) isSuspiciousConnection(ip string, port int) bool {
-	// 检查可疑端口
-	suspiciousPorts := []int{22, 23, 3389, 4444, 5555, 6666, 7777, 8888, 9999}
-	for _, suspPort := range suspiciousPorts {
-		if port == suspPort {
-			return true
-		}
-	}
-
-	// 检查私有 IP 范围外的连接
-	if !nc.isPrivateIP(ip) && ip != "127.0.0.1" && ip != "0.0.0.0" {
-		return true
-	}
-
-	return false
-}
-
-// isPrivateIP 检查是否为私有 IP
-func (nc *NetworkCollector) isPrivateIP(ip string) bool {
-	// 简化的私有 IP 检查
-	return strings.HasPrefix(ip, "10.") ||
-		strings.HasPrefix(ip, "192.168.") ||
-		strings.HasPrefix(ip, "172.")
-}
@@ -0,0 +1,206 @@
+package collector
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wasm-threat-detector/host/internal/procfs"
+)
+
+// minScanInterval 扫描周期的下限，防止漏写单位（例如 scan_interval: 10 会被解析为 10ns）
+const minScanInterval = 100 * time.Millisecond
+
+// ProcessConfig 进程收集器配置，对应 collectors.process
+type ProcessConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// ScanInterval 没有 netlink 进程连接器时轮询进程列表的周期
+	ScanInterval time.Duration `mapstructure:"scan_interval"`
+	// SuspiciousCheckInterval 检查可疑进程的周期
+	SuspiciousCheckInterval time.Duration `mapstructure:"suspicious_check_interval"`
+	// AncestryDepth 进程事件中附加的祖先层数，0 表示不附加
+	AncestryDepth int `mapstructure:"ancestry_depth"`
+}
+
+// DefaultProcessConfig 返回默认进程收集器配置
+func DefaultProcessConfig() ProcessConfig {
+	return ProcessConfig{
+		Enabled:                 true,
+		ScanInterval:            time.Second,
+		SuspiciousCheckInterval: 5 * time.Second,
+		AncestryDepth:           DefaultAncestryDepth,
+	}
+}
+
+// enabled 是否启用收集器
+func (c ProcessConfig) enabled() bool {
+	return c.Enabled
+}
+
+// Validate 校验配置
+func (c ProcessConfig) Validate() error {
+	if err := validateInterval("scan_interval", c.ScanInterval); err != nil {
+		return err
+	}
+	if err := validateInterval("suspicious_check_interval", c.SuspiciousCheckInterval); err != nil {
+		return err
+	}
+	if c.AncestryDepth < 0 {
+		return fmt.Errorf("ancestry_depth must not be negative, got %d", c.AncestryDepth)
+	}
+	return nil
+}
+
+// NetworkConfig 网络收集器配置，对应 collectors.network
+type NetworkConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// ScanInterval 扫描套接字表的周期，也是连接时长的精度
+	ScanInterval time.Duration `mapstructure:"scan_interval"`
+}
+
+// DefaultNetworkConfig 返回默认网络收集器配置
+func DefaultNetworkConfig() NetworkConfig {
+	return NetworkConfig{
+		Enabled:      true,
+		ScanInterval: 10 * time.Second,
+	}
+}
+
+// enabled 是否启用收集器
+func (c NetworkConfig) enabled() bool {
+	return c.Enabled
+}
+
+// Validate 校验配置
+func (c NetworkConfig) Validate() error {
+	return validateInterval("scan_interval", c.ScanInterval)
+}
+
+// FileConfig 文件收集器配置，对应 collectors.file
+//
+// 文件收集器由内核通知驱动，没有扫描周期。
+type FileConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// WatchPaths 递归监控的目录
+	WatchPaths []string `mapstructure:"watch_paths"`
+}
+
+// DefaultFileConfig 返回默认文件收集器配置，默认关闭
+func DefaultFileConfig() FileConfig {
+	return FileConfig{}
+}
+
+// enabled 是否启用收集器
+func (c FileConfig) enabled() bool {
+	return c.Enabled
+}
+
+// Validate 校验配置
+func (c FileConfig) Validate() error {
+	if len(c.WatchPaths) == 0 {
+		return fmt.Errorf("watch_paths must list at least one directory")
+	}
+	for i, path := range c.WatchPaths {
+		if path == "" {
+			return fmt.Errorf("watch_paths[%d] is empty", i)
+		}
+	}
+	return nil
+}
+
+// validateInterval 校验扫描周期
+func validateInterval(name string, interval time.Duration) error {
+	if interval < minScanInterval {
+		return fmt.Errorf("%s must be at least %s, got %s", name, minScanInterval, interval)
+	}
+	return nil
+}
+
+// sectionConfig 收集器配置段
+type sectionConfig interface {
+	enabled() bool
+	Validate() error
+}
+
+// Decoder 将配置文件中 collectors.<name> 段解码到 cfg，段不存在时保留 cfg 中的默认值
+type Decoder func(name string, cfg interface{}) error
+
+// registration 注册的收集器，load 解码并校验配置段，收集器关闭时返回 nil
+type registration struct {
+	name string
+	load func(logger *logrus.Logger, proc *procfs.FS, decode Decoder) (Collector, error)
+}
+
+// register 创建收集器的注册项，配置段从 defaults 开始解码，启用时校验后交给 build
+func register[C sectionConfig](name string, defaults func() C, build func(*logrus.Logger, *procfs.FS, C) Collector) registration {
+	return registration{
+		name: name,
+		load: func(logger *logrus.Logger, proc *procfs.FS, decode Decoder) (Collector, error) {
+			cfg := defaults()
+			if err := decode(name, &cfg); err != nil {
+				return nil, err
+			}
+			if !cfg.enabled() {
+				return nil, nil
+			}
+			if err := cfg.Validate(); err != nil {
+				return nil, err
+			}
+			return build(logger, proc, cfg), nil
+		},
+	}
+}
+
+// registry 所有收集器，按启动顺序排列
+var registry = []registration{
+	register("process", DefaultProcessConfig, func(logger *logrus.Logger, proc *procfs.FS, cfg ProcessConfig) Collector {
+		return NewProcessCollector(logger, proc, cfg)
+	}),
+	register("network", DefaultNetworkConfig, func(logger *logrus.Logger, proc *procfs.FS, cfg NetworkConfig) Collector {
+		return NewNetworkCollector(logger, proc, cfg)
+	}),
+	register("file", DefaultFileConfig, func(logger *logrus.Logger, proc *procfs.FS, cfg FileConfig) Collector {
+		return NewFileCollector(logger, proc, cfg)
+	}),
+}
+
+// Names 返回所有注册的收集器名称
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for _, r := range registry {
+		names = append(names, r.name)
+	}
+	return names
+}
+
+// NewCollectors 按配置创建所有启用的收集器，收集器从 proc 读取 procfs
+//
+// configured 为配置文件 collectors 段中出现的名称，包含未注册的名称时返回错误，以便发现拼写错误。
+func NewCollectors(logger *logrus.Logger, proc *procfs.FS, configured []string, decode Decoder) ([]Collector, error) {
+	known := make(map[string]bool, len(registry))
+	for _, r := range registry {
+		known[r.name] = true
+	}
+	sort.Strings(configured)
+	for _, name := range configured {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown collector %q in collectors config, available: %v", name, Names())
+		}
+	}
+
+	var collectors []Collector
+	for _, r := range registry {
+		collector, err := r.load(logger, proc, decode)
+		if err != nil {
+			return nil, fmt.Errorf("invalid collectors.%s config: %w", r.name, err)
+		}
+		if collector == nil {
+			logger.Infof("Collector %s is disabled", r.name)
+			continue
+		}
+		collectors = append(collectors, collector)
+	}
+
+	return collectors, nil
+}
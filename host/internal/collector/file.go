@@ -0,0 +1,393 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wasm-threat-detector/host/internal/events"
+	"github.com/wasm-threat-detector/host/internal/procfs"
+)
+
+// 文件操作类型，与规则中的 operation 取值一致
+const (
+	fileOpCreate = "create"
+	fileOpWrite  = "write"
+	fileOpDelete = "delete"
+	fileOpChmod  = "chmod"
+	fileOpRename = "rename"
+)
+
+// fileReadTimeout 等待文件事件的超时，用于定期检查收集器是否已停止
+const fileReadTimeout = time.Second
+
+// fileWriteCoalesce 同一文件的连续写入在此时间内只上报一次
+const fileWriteCoalesce = time.Second
+
+// fileModeMask 判断权限是否改变时比较的位：权限和 setuid/setgid/sticky
+const fileModeMask = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+// fileEvent 文件监控后端上报的事件
+type fileEvent struct {
+	path    string
+	newPath string // rename：新路径，移出监控目录时为空
+	op      string // 属性变化上报为 chmod，由收集器判断权限是否改变
+	pid     int32  // 操作文件的进程，0 表示未知
+	dir     bool   // 是否为目录
+}
+
+// fileWatcher 文件监控后端
+type fileWatcher interface {
+	// add 监控目录及其直接子项
+	add(dir string) error
+	// receive 接收一批事件，超时时返回空列表
+	receive() ([]fileEvent, error)
+	close() error
+}
+
+// FileCollector 文件事件收集器
+//
+// 只能监控本机文件系统。proc 的根目录不是 / 时（例如容器中挂载的宿主机根目录 /host），
+// 监控路径相对于该根目录，事件中的路径去掉根目录前缀。
+type FileCollector struct {
+	logger     *logrus.Logger
+	proc       *procfs.FS
+	root       string // 监控路径所在的根目录
+	paths      []string
+	mu         sync.Mutex // 保护 lastWrites 和 modes，fanotify 和 inotify 可能同时在监控
+	lastWrites map[string]time.Time
+	modes      map[string]os.FileMode // 监控路径下文件的权限，用于判断属性变化是否修改了权限
+	eventChan  chan *events.Event
+	done       chan struct{}
+}
+
+// NewFileCollector 创建文件收集器，递归监控 watch_paths 下的所有目录，操作文件的进程从 proc 读取
+func NewFileCollector(logger *logrus.Logger, proc *procfs.FS, config FileConfig) *FileCollector {
+	return &FileCollector{
+		logger:     logger,
+		proc:       proc,
+		paths:      config.WatchPaths,
+		lastWrites: make(map[string]time.Time),
+		modes:      make(map[string]os.FileMode),
+		eventChan:  make(chan *events.Event, 1000),
+		done:       make(chan struct{}),
+	}
+}
+
+// Start 启动文件监控
+//
+// 优先使用 fanotify（需要 CAP_SYS_ADMIN 和 Linux 5.9 以上内核），可以得到操作文件的进程；
+// fanotify 不可用时，以及 fanotify 无法监控的路径（部分文件系统如较老内核上的 overlayfs
+// 不支持 fanotify 的文件句柄模式）回退到 inotify，事件中没有进程信息。
+func (fc *FileCollector) Start(ctx context.Context) error {
+	fc.logger.Info("Starting file collector")
+
+	root, ok := fc.proc.FileSystem().(procfs.DirFS)
+	if !ok {
+		return fmt.Errorf("file collector can only watch a live filesystem")
+	}
+	fc.root = string(root)
+
+	remaining := fc.paths
+	if watcher, err := openFanotify(); err != nil {
+		fc.logger.Warnf("Fanotify unavailable, falling back to inotify without process attribution: %v", err)
+	} else {
+		remaining = fc.watchPaths(watcher, fc.paths, "fanotify")
+		if len(remaining) < len(fc.paths) {
+			fc.logger.Info("Using fanotify for file events")
+			go fc.monitorFiles(ctx, watcher)
+		} else {
+			watcher.close()
+		}
+		if len(remaining) > 0 {
+			fc.logger.Warnf("Falling back to inotify without process attribution for %v", remaining)
+		}
+	}
+	if len(remaining) == 0 {
+		return nil
+	}
+
+	watcher, err := openInotify()
+	if err != nil {
+		return fmt.Errorf("failed to create file watcher: %w", err)
+	}
+	failed := fc.watchPaths(watcher, remaining, "inotify")
+	if len(failed) == len(remaining) {
+		watcher.close()
+		if len(remaining) == len(fc.paths) {
+			return fmt.Errorf("none of the file watch paths %v could be watched", fc.paths)
+		}
+		return nil
+	}
+	go fc.monitorFiles(ctx, watcher)
+
+	return nil
+}
+
+// Stop 停止收集器
+func (fc *FileCollector) Stop() error {
+	fc.logger.Info("Stopping file collector")
+	close(fc.done)
+	close(fc.eventChan)
+	return nil
+}
+
+// EventChannel 返回事件通道
+func (fc *FileCollector) EventChannel() <-chan *events.Event {
+	return fc.eventChan
+}
+
+// send 发送事件，通道满时丢弃
+func (fc *FileCollector) send(event *events.Event) {
+	select {
+	case fc.eventChan <- event:
+	default:
+		fc.logger.Warn("Event channel full, dropping file event")
+	}
+}
+
+// watchPaths 使用 watcher 监控路径，返回无法监控的路径
+func (fc *FileCollector) watchPaths(watcher fileWatcher, paths []string, backend string) []string {
+	var failed []string
+	for _, path := range paths {
+		if err := fc.watchTree(watcher, filepath.Join(fc.root, path)); err != nil {
+			fc.logger.Warnf("Failed to watch %s with %s: %v", path, backend, err)
+			failed = append(failed, path)
+		}
+	}
+	return failed
+}
+
+// watchTree 监控目录及其所有子目录，并记录其中文件的权限，无法访问的子目录只记录调试日志
+func (fc *FileCollector) watchTree(watcher fileWatcher, root string) error {
+	// 不跟随子目录中的符号链接，但允许监控路径本身是符号链接
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", root)
+	}
+
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			fc.logger.Debugf("Skipping %s: %v", path, err)
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			fc.setMode(path, info.Mode())
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if err := watcher.add(path); err != nil {
+			if path == root {
+				return err
+			}
+			fc.logger.Debugf("Failed to watch %s: %v", path, err)
+		}
+		return nil
+	})
+}
+
+// monitorFiles 接收 watcher 的文件事件，新建的目录加入同一个 watcher 的监控
+func (fc *FileCollector) monitorFiles(ctx context.Context, watcher fileWatcher) {
+	defer watcher.close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-fc.done:
+			return
+		default:
+		}
+
+		fileEvents, err := watcher.receive()
+		if err != nil {
+			fc.logger.Warnf("Failed to receive file events: %v", err)
+			continue
+		}
+
+		for _, fe := range fileEvents {
+			now := time.Now()
+			switch fe.op {
+			case fileOpCreate:
+				fc.updateMode(fe.path)
+			case fileOpWrite:
+				if !fc.firstWrite(fe.path, now) {
+					continue
+				}
+			case fileOpChmod:
+				// 修改所有者、时间戳等属性也会产生属性变化事件，只上报权限的变化
+				if changed, err := fc.updateMode(fe.path); err != nil || !changed {
+					continue
+				}
+			case fileOpDelete, fileOpRename:
+				fc.forgetModes(fe.path, fe.dir)
+				if fe.newPath != "" {
+					fc.updateMode(fe.newPath)
+				}
+			}
+
+			// 新建、移入或改名的目录中的文件也需要监控
+			if fe.dir && fe.op == fileOpCreate {
+				if err := fc.watchTree(watcher, fe.path); err != nil {
+					fc.logger.Debugf("Failed to watch new directory %s: %v", fe.path, err)
+				}
+			}
+			if fe.dir && fe.op == fileOpRename && fe.newPath != "" {
+				if err := fc.watchTree(watcher, fe.newPath); err != nil {
+					fc.logger.Debugf("Failed to watch renamed directory %s: %v", fe.newPath, err)
+				}
+			}
+			fc.send(fc.fileEvent(fe, now))
+		}
+	}
+}
+
+// firstWrite 判断是否为合并窗口内对文件的第一次写入
+func (fc *FileCollector) firstWrite(path string, now time.Time) bool {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	if last, ok := fc.lastWrites[path]; ok && now.Sub(last) < fileWriteCoalesce {
+		return false
+	}
+
+	// 定期清理过期记录，避免持续写入大量不同文件时无限增长
+	if len(fc.lastWrites) >= 4096 {
+		for p, last := range fc.lastWrites {
+			if now.Sub(last) >= fileWriteCoalesce {
+				delete(fc.lastWrites, p)
+			}
+		}
+	}
+	fc.lastWrites[path] = now
+
+	return true
+}
+
+// setMode 记录文件的权限
+func (fc *FileCollector) setMode(path string, mode os.FileMode) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	fc.modes[path] = mode & fileModeMask
+}
+
+// updateMode 读取文件当前的权限并更新记录，返回权限是否改变，之前没有记录时视为改变
+func (fc *FileCollector) updateMode(path string) (bool, error) {
+	stat, err := os.Lstat(path)
+	if err != nil {
+		return false, err
+	}
+	mode := stat.Mode() & fileModeMask
+
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	old, known := fc.modes[path]
+	fc.modes[path] = mode
+	return !known || old != mode, nil
+}
+
+// forgetModes 删除文件的权限记录，目录同时删除其中所有文件的记录
+func (fc *FileCollector) forgetModes(path string, dir bool) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	delete(fc.modes, path)
+	if !dir {
+		return
+	}
+	prefix := path + string(filepath.Separator)
+	for p := range fc.modes {
+		if strings.HasPrefix(p, prefix) {
+			delete(fc.modes, p)
+		}
+	}
+}
+
+// fileEvent 将文件监控事件转换为文件事件，补充文件权限和操作进程
+func (fc *FileCollector) fileEvent(fe fileEvent, now time.Time) *events.Event {
+	info := events.FileInfo{
+		Path:      fc.hostPath(fe.path),
+		Operation: fe.op,
+		PID:       fe.pid,
+	}
+
+	// 删除之后文件已不存在，改名后的权限从新路径读取
+	current := fe.path
+	switch {
+	case fe.op == fileOpDelete:
+		current = ""
+	case fe.op == fileOpRename:
+		current = fe.newPath
+		if fe.newPath != "" {
+			info.NewPath = fc.hostPath(fe.newPath)
+		}
+	}
+	if current != "" {
+		if stat, err := os.Lstat(current); err == nil {
+			info.Permissions = filePermissions(stat.Mode())
+		}
+	}
+
+	// 进程可能已经退出，此时只上报 PID
+	if fe.pid > 0 {
+		if proc, err := fc.proc.ReadProcess(fe.pid); err == nil {
+			info.ProcessName = proc.Name
+			info.User = strconv.FormatUint(uint64(proc.UID), 10)
+		}
+	}
+
+	return &events.Event{
+		SchemaVersion: events.CurrentSchemaVersion,
+		ID:            fmt.Sprintf("file_%s_%d", fe.op, now.UnixNano()),
+		Type:          events.EventTypeFile,
+		Timestamp:     now,
+		Source:        "file_collector",
+		Data: map[string]interface{}{
+			"file": info,
+		},
+	}
+}
+
+// hostPath 去掉根目录前缀，返回路径在被监控系统上的路径
+func (fc *FileCollector) hostPath(path string) string {
+	rel, err := filepath.Rel(fc.root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return string(filepath.Separator) + rel
+}
+
+// filePermissions 以八进制格式返回文件权限，包括 setuid/setgid/sticky 位
+func filePermissions(mode os.FileMode) string {
+	perm := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		perm |= 0o4000
+	}
+	if mode&os.ModeSetgid != 0 {
+		perm |= 0o2000
+	}
+	if mode&os.ModeSticky != 0 {
+		perm |= 0o1000
+	}
+	return fmt.Sprintf("%04o", perm)
+}
@@ -0,0 +1,271 @@
+//go:build linux
+
+package collector
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// fanotifyMask 监控的文件事件，改名事件见 fanotifyWatcher.moveMask
+const fanotifyMask = unix.FAN_CREATE | unix.FAN_DELETE | unix.FAN_MODIFY | unix.FAN_ATTRIB |
+	unix.FAN_ONDIR | unix.FAN_EVENT_ON_CHILD
+
+// sizeofFanotifyEventMetadata struct fanotify_event_metadata 的大小
+const sizeofFanotifyEventMetadata = 24
+
+// struct fanotify_event_info_fid 中 file_handle 之前的部分：info 头（4 字节）、fsid（8 字节）、
+// handle_bytes 和 handle_type（各 4 字节）
+const (
+	sizeofFanotifyInfoHeader = 4
+	sizeofFanotifyFidHeader  = sizeofFanotifyInfoHeader + 16
+)
+
+// fanotifyWatcher 基于 fanotify 的文件监控
+//
+// 使用 FAN_REPORT_DFID_NAME 模式，事件中带有父目录的文件句柄和文件名。
+// 添加监控时记录每个目录的句柄，用于把事件还原为路径。
+type fanotifyWatcher struct {
+	fd       int
+	buf      []byte
+	self     int32
+	dirs     map[string]string // 目录句柄（fsid + handle）-> 路径
+	moveMask uint64            // FAN_RENAME（Linux 5.17 以上），内核不支持时为 FAN_MOVED_FROM 和 FAN_MOVED_TO
+}
+
+// openFanotify 创建 fanotify 监控，需要 CAP_SYS_ADMIN 和 Linux 5.9 以上内核
+func openFanotify() (*fanotifyWatcher, error) {
+	fd, err := unix.FanotifyInit(unix.FAN_CLASS_NOTIF|unix.FAN_CLOEXEC|unix.FAN_NONBLOCK|unix.FAN_REPORT_DFID_NAME,
+		unix.O_RDONLY|unix.O_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize fanotify: %w", err)
+	}
+
+	return &fanotifyWatcher{
+		fd:       fd,
+		buf:      make([]byte, 64*1024),
+		self:     int32(os.Getpid()),
+		dirs:     make(map[string]string),
+		moveMask: unix.FAN_RENAME,
+	}, nil
+}
+
+// add 监控目录及其直接子项
+func (w *fanotifyWatcher) add(dir string) error {
+	key, err := fanotifyDirKey(dir)
+	if err != nil {
+		return err
+	}
+	err = unix.FanotifyMark(w.fd, unix.FAN_MARK_ADD|unix.FAN_MARK_ONLYDIR, fanotifyMask|w.moveMask, unix.AT_FDCWD, dir)
+	if err == unix.EINVAL && w.moveMask == unix.FAN_RENAME {
+		// 内核不支持 FAN_RENAME，改名的新旧路径分别上报
+		w.moveMask = unix.FAN_MOVED_FROM | unix.FAN_MOVED_TO
+		err = unix.FanotifyMark(w.fd, unix.FAN_MARK_ADD|unix.FAN_MARK_ONLYDIR, fanotifyMask|w.moveMask, unix.AT_FDCWD, dir)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to add fanotify mark: %w", err)
+	}
+	w.dirs[key] = dir
+	return nil
+}
+
+// fanotifyDirKey 计算目录的句柄，格式与事件中的 fsid 和 file_handle 相同
+func fanotifyDirKey(dir string) (string, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(dir, &stat); err != nil {
+		return "", fmt.Errorf("failed to stat filesystem: %w", err)
+	}
+	handle, _, err := unix.NameToHandleAt(unix.AT_FDCWD, dir, unix.AT_SYMLINK_FOLLOW)
+	if err != nil {
+		return "", fmt.Errorf("failed to get file handle: %w", err)
+	}
+
+	order := binary.NativeEndian
+	key := make([]byte, 16+handle.Size())
+	order.PutUint32(key[0:], uint32(stat.Fsid.Val[0]))
+	order.PutUint32(key[4:], uint32(stat.Fsid.Val[1]))
+	order.PutUint32(key[8:], uint32(handle.Size()))
+	order.PutUint32(key[12:], uint32(handle.Type()))
+	copy(key[16:], handle.Bytes())
+
+	return string(key), nil
+}
+
+// receive 接收一批文件事件，超时时返回空列表
+func (w *fanotifyWatcher) receive() ([]fileEvent, error) {
+	n, err := readWithTimeout(w.fd, w.buf)
+	if err != nil || n == 0 {
+		return nil, err
+	}
+	return w.parseEvents(w.buf[:n])
+}
+
+// close 关闭 fanotify，同时移除所有监控
+func (w *fanotifyWatcher) close() error {
+	return unix.Close(w.fd)
+}
+
+// parseEvents 解析 fanotify 事件，忽略本进程的操作和不在监控目录中的事件
+func (w *fanotifyWatcher) parseEvents(data []byte) ([]fileEvent, error) {
+	var result []fileEvent
+	var overflow bool
+
+	order := binary.NativeEndian
+	for len(data) >= sizeofFanotifyEventMetadata {
+		// struct fanotify_event_metadata
+		length := int(order.Uint32(data[0:]))
+		version := data[4]
+		metadataLen := int(order.Uint16(data[6:]))
+		mask := order.Uint64(data[8:])
+		pid := int32(order.Uint32(data[20:]))
+
+		if version != unix.FANOTIFY_METADATA_VERSION {
+			return result, fmt.Errorf("unsupported fanotify metadata version %d", version)
+		}
+		if metadataLen < sizeofFanotifyEventMetadata || length < metadataLen || length > len(data) {
+			break
+		}
+
+		switch {
+		case mask&unix.FAN_Q_OVERFLOW != 0:
+			overflow = true
+		case pid != w.self:
+			paths := w.eventPaths(data[metadataLen:length])
+			if mask&unix.FAN_RENAME != 0 {
+				result = append(result, w.renameEvents(mask, pid, paths)...)
+			} else if path, ok := paths[unix.FAN_EVENT_INFO_TYPE_DFID_NAME]; ok {
+				result = append(result, w.events(mask, pid, path)...)
+			} else if path, ok := paths[unix.FAN_EVENT_INFO_TYPE_DFID]; ok {
+				result = append(result, w.events(mask, pid, path)...)
+			}
+		}
+
+		data = data[length:]
+	}
+
+	if overflow {
+		return result, errors.New("fanotify event queue overflowed, some file events were lost")
+	}
+	return result, nil
+}
+
+// eventPaths 从目录句柄和文件名信息记录中还原文件路径，返回信息类型到路径的映射
+//
+// 普通事件只有 DFID_NAME（或 DFID）记录，FAN_RENAME 事件有 OLD_DFID_NAME 和 NEW_DFID_NAME 两条记录。
+// 目录不在监控中的记录被忽略。
+func (w *fanotifyWatcher) eventPaths(info []byte) map[uint8]string {
+	order := binary.NativeEndian
+	paths := make(map[uint8]string, 1)
+
+	for len(info) >= sizeofFanotifyFidHeader {
+		infoType := info[0]
+		length := int(order.Uint16(info[2:]))
+		if length < sizeofFanotifyFidHeader || length > len(info) {
+			break
+		}
+		record := info[:length]
+		info = info[length:]
+
+		switch infoType {
+		case unix.FAN_EVENT_INFO_TYPE_DFID_NAME, unix.FAN_EVENT_INFO_TYPE_DFID,
+			unix.FAN_EVENT_INFO_TYPE_OLD_DFID_NAME, unix.FAN_EVENT_INFO_TYPE_NEW_DFID_NAME:
+		default:
+			continue
+		}
+
+		handleBytes := int(order.Uint32(record[sizeofFanotifyInfoHeader+8:]))
+		end := sizeofFanotifyFidHeader + handleBytes
+		if end > len(record) {
+			break
+		}
+		dir, ok := w.dirs[string(record[sizeofFanotifyInfoHeader:end])]
+		if !ok {
+			continue
+		}
+
+		name := record[end:]
+		if i := bytes.IndexByte(name, 0); i >= 0 {
+			name = name[:i]
+		}
+		if len(name) == 0 || string(name) == "." {
+			paths[infoType] = dir
+		} else {
+			paths[infoType] = filepath.Join(dir, string(name))
+		}
+	}
+
+	return paths
+}
+
+// renameEvents 将 FAN_RENAME 事件转换为文件事件
+//
+// 新旧目录都在监控中时上报一个带有新旧路径的 rename 事件；移出监控目录时上报没有新路径的 rename，
+// 移入监控目录时上报 create，与 inotify 一致。
+func (w *fanotifyWatcher) renameEvents(mask uint64, pid int32, paths map[uint8]string) []fileEvent {
+	dir := mask&unix.FAN_ONDIR != 0
+	oldPath, fromWatched := paths[unix.FAN_EVENT_INFO_TYPE_OLD_DFID_NAME]
+	newPath := paths[unix.FAN_EVENT_INFO_TYPE_NEW_DFID_NAME]
+
+	if !fromWatched {
+		if newPath == "" {
+			return nil
+		}
+		return []fileEvent{{path: newPath, op: fileOpCreate, pid: pid, dir: dir}}
+	}
+
+	// 目录被移走后不再需要它及其子目录的句柄，新路径会重新添加
+	if dir {
+		w.forget(oldPath)
+	}
+	return []fileEvent{{path: oldPath, newPath: newPath, op: fileOpRename, pid: pid, dir: dir}}
+}
+
+// events 将事件掩码拆分为文件事件
+//
+// 内核不支持 FAN_RENAME 时，移入监控目录的文件上报为 create，移出或改名的旧路径上报为没有新路径的 rename。
+func (w *fanotifyWatcher) events(mask uint64, pid int32, path string) []fileEvent {
+	var result []fileEvent
+	ops := []struct {
+		mask uint64
+		name string
+	}{
+		{unix.FAN_CREATE, fileOpCreate},
+		{unix.FAN_MOVED_TO, fileOpCreate},
+		{unix.FAN_MODIFY, fileOpWrite},
+		{unix.FAN_ATTRIB, fileOpChmod},
+		{unix.FAN_MOVED_FROM, fileOpRename},
+		{unix.FAN_DELETE, fileOpDelete},
+	}
+
+	dir := mask&unix.FAN_ONDIR != 0
+	for _, o := range ops {
+		if mask&o.mask == 0 {
+			continue
+		}
+		result = append(result, fileEvent{path: path, op: o.name, pid: pid, dir: dir})
+
+		// 目录被删除或移走后不再需要它及其子目录的句柄，移入时会重新添加
+		if dir && (o.mask == unix.FAN_DELETE || o.mask == unix.FAN_MOVED_FROM) {
+			w.forget(path)
+		}
+	}
+
+	return result
+}
+
+// forget 移除目录及其子目录的句柄
+func (w *fanotifyWatcher) forget(path string) {
+	prefix := path + string(filepath.Separator)
+	for key, dir := range w.dirs {
+		if dir == path || strings.HasPrefix(dir, prefix) {
+			delete(w.dirs, key)
+		}
+	}
+}
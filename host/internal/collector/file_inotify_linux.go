@@ -0,0 +1,197 @@
+//go:build linux
+
+package collector
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// inotifyMask 监控的文件事件，目录自身的事件（IN_DELETE_SELF、IN_MOVE_SELF）由父目录上报
+const inotifyMask = unix.IN_CREATE | unix.IN_MODIFY | unix.IN_ATTRIB | unix.IN_MOVED_FROM |
+	unix.IN_MOVED_TO | unix.IN_DELETE | unix.IN_ONLYDIR
+
+// inotifyWatcher 基于 inotify 的文件监控，没有进程信息
+type inotifyWatcher struct {
+	fd     int
+	buf    []byte
+	paths  map[int32]string // 监控描述符 -> 目录路径
+	move   *fileEvent       // 等待配对 IN_MOVED_TO 的 IN_MOVED_FROM
+	cookie uint32           // move 的 cookie
+}
+
+// openInotify 创建 inotify 监控
+func openInotify() (*inotifyWatcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize inotify: %w", err)
+	}
+
+	return &inotifyWatcher{
+		fd:    fd,
+		buf:   make([]byte, 64*1024),
+		paths: make(map[int32]string),
+	}, nil
+}
+
+// add 监控目录及其直接子项，已监控的目录（如被移动后）更新路径
+func (w *inotifyWatcher) add(dir string) error {
+	wd, err := unix.InotifyAddWatch(w.fd, dir, inotifyMask)
+	if err != nil {
+		return fmt.Errorf("failed to add inotify watch: %w", err)
+	}
+	w.paths[int32(wd)] = dir
+	return nil
+}
+
+// receive 接收一批文件事件，超时时返回空列表
+func (w *inotifyWatcher) receive() ([]fileEvent, error) {
+	n, err := readWithTimeout(w.fd, w.buf)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		// 一段时间内没有配对的 IN_MOVED_TO，文件已被移出监控目录
+		return w.flushMove(nil), nil
+	}
+	return w.parseEvents(w.buf[:n])
+}
+
+// close 关闭 inotify，同时移除所有监控
+func (w *inotifyWatcher) close() error {
+	return unix.Close(w.fd)
+}
+
+// parseEvents 解析 inotify 事件
+func (w *inotifyWatcher) parseEvents(data []byte) ([]fileEvent, error) {
+	order := binary.NativeEndian
+	var result []fileEvent
+	var overflow bool
+
+	for len(data) >= unix.SizeofInotifyEvent {
+		// struct inotify_event
+		wd := int32(order.Uint32(data[0:]))
+		mask := order.Uint32(data[4:])
+		cookie := order.Uint32(data[8:])
+		nameLen := int(order.Uint32(data[12:]))
+		length := unix.SizeofInotifyEvent + nameLen
+		if length > len(data) {
+			break
+		}
+		name := strings.TrimRight(string(data[unix.SizeofInotifyEvent:length]), "\x00")
+		data = data[length:]
+
+		switch {
+		case mask&unix.IN_Q_OVERFLOW != 0:
+			overflow = true
+		case mask&unix.IN_IGNORED != 0:
+			// 目录被删除或监控被移除
+			delete(w.paths, wd)
+		case name != "":
+			// 没有文件名的是目录自身的事件，父目录已经上报过
+			if dir, ok := w.paths[wd]; ok {
+				result = w.event(result, mask, cookie, filepath.Join(dir, name))
+			}
+		}
+	}
+
+	if overflow {
+		return result, errors.New("inotify event queue overflowed, some file events were lost")
+	}
+	return result, nil
+}
+
+// event 将一个 inotify 事件追加到 result
+//
+// IN_MOVED_FROM 和 cookie 相同的 IN_MOVED_TO 合并为一个 rename 事件，带有新旧路径；
+// 移出监控目录的文件上报为没有新路径的 rename，移入监控目录的文件上报为 create，与 fanotify 一致。
+// IN_MOVED_FROM 留到下一个事件才上报，批次末尾的 IN_MOVED_FROM 等到下一次读取。
+func (w *inotifyWatcher) event(result []fileEvent, mask, cookie uint32, path string) []fileEvent {
+	dir := mask&unix.IN_ISDIR != 0
+
+	if mask&unix.IN_MOVED_TO != 0 && w.move != nil && w.cookie == cookie {
+		w.move.newPath = path
+		result = append(result, *w.move)
+		w.move = nil
+		return result
+	}
+	result = w.flushMove(result)
+
+	if mask&unix.IN_MOVED_FROM != 0 {
+		w.move = &fileEvent{path: path, op: fileOpRename, dir: dir}
+		w.cookie = cookie
+		// 移走的目录可能已经不在监控路径下，移除它及其子目录的监控，移入时会重新添加
+		if dir {
+			w.forget(path)
+		}
+		return result
+	}
+
+	ops := []struct {
+		mask uint32
+		name string
+	}{
+		{unix.IN_CREATE, fileOpCreate},
+		{unix.IN_MOVED_TO, fileOpCreate},
+		{unix.IN_MODIFY, fileOpWrite},
+		{unix.IN_ATTRIB, fileOpChmod},
+		{unix.IN_DELETE, fileOpDelete},
+	}
+	for _, o := range ops {
+		if mask&o.mask != 0 {
+			result = append(result, fileEvent{path: path, op: o.name, dir: dir})
+		}
+	}
+
+	return result
+}
+
+// flushMove 把没有配对的 IN_MOVED_FROM 作为 rename 事件追加到 result
+func (w *inotifyWatcher) flushMove(result []fileEvent) []fileEvent {
+	if w.move != nil {
+		result = append(result, *w.move)
+		w.move = nil
+	}
+	return result
+}
+
+// forget 移除目录及其子目录的监控
+func (w *inotifyWatcher) forget(path string) {
+	prefix := path + string(filepath.Separator)
+	for wd, dir := range w.paths {
+		if dir == path || strings.HasPrefix(dir, prefix) {
+			unix.InotifyRmWatch(w.fd, uint32(wd))
+			delete(w.paths, wd)
+		}
+	}
+}
+
+// readWithTimeout 等待描述符可读后读取一批事件，超时时返回 0
+func readWithTimeout(fd int, buf []byte) (int, error) {
+	fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+	n, err := unix.Poll(fds, int(fileReadTimeout.Milliseconds()))
+	if err != nil {
+		if err == unix.EINTR {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if n == 0 {
+		return 0, nil
+	}
+
+	n, err = unix.Read(fd, buf)
+	if err != nil {
+		if err == unix.EAGAIN || err == unix.EINTR {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	return n, nil
+}
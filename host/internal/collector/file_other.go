@@ -0,0 +1,51 @@
+//go:build !linux
+
+package collector
+
+import "errors"
+
+// fanotifyWatcher 非 Linux 平台不支持 fanotify
+type fanotifyWatcher struct{}
+
+// openFanotify 非 Linux 平台始终返回错误
+func openFanotify() (*fanotifyWatcher, error) {
+	return nil, errors.New("fanotify is only available on Linux")
+}
+
+// add 非 Linux 平台不会被调用
+func (w *fanotifyWatcher) add(dir string) error {
+	return nil
+}
+
+// receive 非 Linux 平台不会被调用
+func (w *fanotifyWatcher) receive() ([]fileEvent, error) {
+	return nil, nil
+}
+
+// close 非 Linux 平台不会被调用
+func (w *fanotifyWatcher) close() error {
+	return nil
+}
+
+// inotifyWatcher 非 Linux 平台不支持 inotify
+type inotifyWatcher struct{}
+
+// openInotify 非 Linux 平台始终返回错误，文件收集器无法启动
+func openInotify() (*inotifyWatcher, error) {
+	return nil, errors.New("inotify is only available on Linux")
+}
+
+// add 非 Linux 平台不会被调用
+func (w *inotifyWatcher) add(dir string) error {
+	return nil
+}
+
+// receive 非 Linux 平台不会被调用
+func (w *inotifyWatcher) receive() ([]fileEvent, error) {
+	return nil, nil
+}
+
+// close 非 Linux 平台不会被调用
+func (w *inotifyWatcher) close() error {
+	return nil
+}
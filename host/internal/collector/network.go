@@ -0,0 +1,457 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wasm-threat-detector/host/internal/events"
+	"github.com/wasm-threat-detector/host/internal/procfs"
+)
+
+// 网络连接方向
+const (
+	directionInbound  = "inbound"
+	directionOutbound = "outbound"
+)
+
+// 连接事件的 action
+const (
+	connectionOpen  = "open"
+	connectionClose = "close"
+)
+
+// connection 正在跟踪的连接
+type connection struct {
+	id          string // open 事件的 ID，close 事件通过 connection_id 引用
+	info        events.NetworkInfo
+	openedAt    time.Time // 第一次看到连接的时间
+	inode       uint64
+	counters    tcpCounters
+	hasCounters bool
+	closed      bool // 已进入 TIME_WAIT 或 CLOSE，等待从套接字表中消失
+}
+
+// tcpCounters TCP 连接的字节计数
+type tcpCounters struct {
+	sent     uint64 // 已被对端确认的发送字节数
+	received uint64
+}
+
+// NetworkCollector 网络事件收集器
+//
+// 定期读取 /proc/net 下的 TCP、UDP 和 raw 套接字表。可疑连接在第一次出现时上报 open，
+// 关闭时上报 close；监听套接字和 raw 套接字只在第一次出现时上报。
+// 事件中的进程通过 /proc/<pid>/fd 中的套接字 inode 查找。
+type NetworkCollector struct {
+	logger      *logrus.Logger
+	proc        *procfs.FS
+	config      NetworkConfig
+	reported    map[string]bool        // 已上报的监听和 raw 套接字
+	connections map[string]*connection // 已上报 open 的连接
+	eventChan   chan *events.Event
+	done        chan struct{}
+}
+
+// NewNetworkCollector 创建网络收集器，套接字表和进程信息从 proc 读取
+func NewNetworkCollector(logger *logrus.Logger, proc *procfs.FS, config NetworkConfig) *NetworkCollector {
+	return &NetworkCollector{
+		logger:      logger,
+		proc:        proc,
+		config:      config,
+		reported:    make(map[string]bool),
+		connections: make(map[string]*connection),
+		eventChan:   make(chan *events.Event, 1000),
+		done:        make(chan struct{}),
+	}
+}
+
+// Start 启动网络监控
+func (nc *NetworkCollector) Start(ctx context.Context) error {
+	nc.logger.Info("Starting network collector")
+
+	go nc.monitorConnections(ctx)
+
+	return nil
+}
+
+// Stop 停止收集器
+func (nc *NetworkCollector) Stop() error {
+	nc.logger.Info("Stopping network collector")
+	close(nc.done)
+	close(nc.eventChan)
+	return nil
+}
+
+// EventChannel 返回事件通道
+func (nc *NetworkCollector) EventChannel() <-chan *events.Event {
+	return nc.eventChan
+}
+
+// send 发送事件，通道满时丢弃
+func (nc *NetworkCollector) send(event *events.Event) {
+	select {
+	case nc.eventChan <- event:
+	default:
+		nc.logger.Warn("Event channel full, dropping network event")
+	}
+}
+
+// monitorConnections 监控网络连接
+func (nc *NetworkCollector) monitorConnections(ctx context.Context) {
+	ticker := time.NewTicker(nc.config.ScanInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-nc.done:
+			return
+		case <-ticker.C:
+			if err := nc.checkNetworkConnections(); err != nil {
+				nc.logger.Warnf("Failed to read sockets: %v", err)
+			}
+		}
+	}
+}
+
+// ScanOnce 扫描一次套接字表，用于离线分析快照，只会上报 open、listen 和 raw 事件
+func (nc *NetworkCollector) ScanOnce() error {
+	return nc.checkNetworkConnections()
+}
+
+// checkNetworkConnections 扫描所有套接字，上报新的监听和 raw 套接字以及可疑连接的打开和关闭
+func (nc *NetworkCollector) checkNetworkConnections() error {
+	sockets, err := nc.proc.ReadSockets()
+	if err != nil {
+		return err
+	}
+
+	ephemeral := nc.proc.LocalPortRange()
+	listening := listeningPorts(sockets, ephemeral)
+	owners := &socketOwners{logger: nc.logger, proc: nc.proc}
+	current := make(map[string]bool)
+	seen := make(map[string]bool)
+	now := time.Now()
+
+	for i := range sockets {
+		socket := &sockets[i]
+
+		switch {
+		case socket.Listening(ephemeral):
+			key := socketKey(socket)
+			current[key] = true
+			if !nc.reported[key] {
+				info := listenInfo(socket)
+				owners.attribute(&info, socket.Inode)
+				nc.send(nc.listenEvent(socket, info))
+			}
+		case socket.Transport() == "raw":
+			key := socketKey(socket)
+			current[key] = true
+			if !nc.reported[key] {
+				info := rawInfo(socket)
+				owners.attribute(&info, socket.Inode)
+				nc.send(nc.rawEvent(socket, info))
+			}
+		case socket.RemotePort != 0:
+			key := connectionKey(socket)
+			conn, ok := nc.connections[key]
+			if !ok {
+				info := connectionInfo(socket, listening)
+				if !nc.isSuspiciousConnection(socket.RemoteIP.String(), info.DestPort) {
+					continue
+				}
+				owners.attribute(&info, socket.Inode)
+				conn = &connection{info: info, openedAt: now}
+				nc.connections[key] = conn
+				nc.send(nc.openEvent(conn))
+			}
+
+			seen[key] = true
+			if conn.closed {
+				continue
+			}
+			conn.info.State = socket.State
+			if socket.Inode != 0 {
+				conn.inode = socket.Inode
+			}
+			// 进程关闭套接字后连接进入 TIME_WAIT 或 CLOSE，会在套接字表中保留一段时间
+			if socket.State == "TIME_WAIT" || socket.State == "CLOSE" {
+				conn.closed = true
+				nc.send(nc.closeEvent(conn, now))
+			}
+		}
+	}
+
+	nc.updateCounters()
+
+	// 从套接字表中消失的连接
+	for key, conn := range nc.connections {
+		if seen[key] {
+			continue
+		}
+		if !conn.closed {
+			nc.send(nc.closeEvent(conn, now))
+		}
+		delete(nc.connections, key)
+	}
+
+	// 关闭后重新打开的监听套接字会再次上报
+	nc.reported = current
+	return nil
+}
+
+// updateCounters 记录打开中的 TCP 连接的字节计数
+//
+// 套接字关闭后无法再读取计数，close 事件中是最后一次扫描时的值。
+func (nc *NetworkCollector) updateCounters() {
+	// 字节计数来自本机内核，与快照中的套接字无关
+	if !nc.proc.Live() {
+		return
+	}
+	var counters map[uint64]tcpCounters
+	for _, conn := range nc.connections {
+		if conn.closed || conn.inode == 0 || !strings.HasPrefix(conn.info.Protocol, "tcp") {
+			continue
+		}
+		if counters == nil {
+			var err error
+			if counters, err = readTCPCounters(); err != nil {
+				nc.logger.Debugf("Failed to read TCP byte counters: %v", err)
+				return
+			}
+		}
+		if c, ok := counters[conn.inode]; ok {
+			conn.counters = c
+			conn.hasCounters = true
+		}
+	}
+}
+
+// listeningPorts 返回监听中的端口，按 tcp/udp 区分，不区分 IP 版本
+func listeningPorts(sockets []procfs.Socket, ephemeral procfs.PortRange) map[string]bool {
+	ports := make(map[string]bool)
+	for i := range sockets {
+		if sockets[i].Listening(ephemeral) {
+			ports[portKey(sockets[i].Transport(), sockets[i].LocalPort)] = true
+		}
+	}
+	return ports
+}
+
+// portKey 返回协议和端口组成的键
+func portKey(transport string, port int) string {
+	return transport + "/" + strconv.Itoa(port)
+}
+
+// connectionKey 返回由协议和两端地址组成的键，连接进入 TIME_WAIT 后 inode 变为 0，不能用于标识连接
+func connectionKey(socket *procfs.Socket) string {
+	return socket.Protocol + "/" +
+		net.JoinHostPort(socket.LocalIP.String(), strconv.Itoa(socket.LocalPort)) + "/" +
+		net.JoinHostPort(socket.RemoteIP.String(), strconv.Itoa(socket.RemotePort))
+}
+
+// socketKey 返回唯一标识套接字的键
+func socketKey(socket *procfs.Socket) string {
+	return socket.Protocol + "/" + strconv.FormatUint(socket.Inode, 10) + "/" +
+		net.JoinHostPort(socket.LocalIP.String(), strconv.Itoa(socket.LocalPort))
+}
+
+// connectionInfo 根据监听端口判断连接方向，source 为发起连接的一方，dest 为被连接的一方
+func connectionInfo(socket *procfs.Socket, listening map[string]bool) events.NetworkInfo {
+	local, remote := socket.LocalIP.String(), socket.RemoteIP.String()
+	info := events.NetworkInfo{
+		Protocol:  socket.Protocol,
+		Direction: directionOutbound,
+		State:     socket.State,
+	}
+
+	// 本地端口正在监听，或者是服务端的半连接，说明连接由对端发起
+	if socket.State == "SYN_RECV" || socket.State == "NEW_SYN_RECV" ||
+		listening[portKey(socket.Transport(), socket.LocalPort)] {
+		info.Direction = directionInbound
+		info.SourceIP, info.SourcePort = remote, socket.RemotePort
+		info.DestIP, info.DestPort = local, socket.LocalPort
+		return info
+	}
+
+	info.SourceIP, info.SourcePort = local, socket.LocalPort
+	info.DestIP, info.DestPort = remote, socket.RemotePort
+	return info
+}
+
+// listenInfo 返回监听套接字的网络信息，dest 为监听的地址
+func listenInfo(socket *procfs.Socket) events.NetworkInfo {
+	return events.NetworkInfo{
+		Protocol:  socket.Protocol,
+		DestIP:    socket.LocalIP.String(),
+		DestPort:  socket.LocalPort,
+		Direction: directionInbound,
+		State:     socket.State,
+	}
+}
+
+// rawInfo 返回 raw 套接字的网络信息，raw 套接字没有端口
+func rawInfo(socket *procfs.Socket) events.NetworkInfo {
+	return events.NetworkInfo{
+		Protocol: socket.Protocol,
+		DestIP:   socket.LocalIP.String(),
+		State:    socket.State,
+	}
+}
+
+// socketOwners 一次扫描中套接字 inode 到进程的映射，只在第一次需要时扫描 /proc/<pid>/fd
+type socketOwners struct {
+	logger *logrus.Logger
+	proc   *procfs.FS
+	pids   map[uint64]int32
+	procs  map[int32]*procfs.Process
+}
+
+// attribute 在网络信息中填入持有套接字的进程
+//
+// TIME_WAIT 等已不属于任何进程的套接字 inode 为 0；进程在扫描之间退出时只能得到 PID。
+func (o *socketOwners) attribute(info *events.NetworkInfo, inode uint64) {
+	if inode == 0 {
+		return
+	}
+	if o.pids == nil {
+		pids, err := o.proc.SocketOwners()
+		if err != nil {
+			o.logger.Warnf("Failed to map sockets to processes: %v", err)
+			pids = make(map[uint64]int32)
+		}
+		o.pids = pids
+		o.procs = make(map[int32]*procfs.Process)
+	}
+
+	pid, ok := o.pids[inode]
+	if !ok {
+		return
+	}
+	info.PID = pid
+
+	proc, ok := o.procs[pid]
+	if !ok {
+		proc, _ = o.proc.ReadProcess(pid)
+		o.procs[pid] = proc
+	}
+	if proc == nil {
+		return
+	}
+	info.ProcessName = proc.Name
+	info.Executable = proc.Executable
+	info.User = strconv.FormatUint(uint64(proc.UID), 10)
+}
+
+// openEvent 创建连接打开的事件，并把事件 ID 记录为连接 ID
+func (nc *NetworkCollector) openEvent(conn *connection) *events.Event {
+	now := time.Now()
+	conn.id = fmt.Sprintf("net_%s_%s_%d", connectionOpen, conn.info.Protocol, now.UnixNano())
+	return &events.Event{
+		SchemaVersion: events.CurrentSchemaVersion,
+		ID:            conn.id,
+		Type:          events.EventTypeNetwork,
+		Timestamp:     now,
+		Source:        "network_collector",
+		Data: map[string]interface{}{
+			"action":        connectionOpen,
+			"connection_id": conn.id,
+			"network":       conn.info,
+			"risk_level":    "high",
+		},
+	}
+}
+
+// closeEvent 创建连接关闭的事件，包含连接时长和能够得到的字节计数
+//
+// 时长从第一次看到连接开始计算，精度为扫描周期。
+func (nc *NetworkCollector) closeEvent(conn *connection, closedAt time.Time) *events.Event {
+	now := time.Now()
+	info := conn.info
+	data := map[string]interface{}{
+		"action":        connectionClose,
+		"connection_id": conn.id,
+		"risk_level":    "high",
+		"open_time":     conn.openedAt,
+		"close_time":    closedAt,
+		"duration_ms":   closedAt.Sub(conn.openedAt).Milliseconds(),
+	}
+	if conn.hasCounters {
+		data["bytes_sent"] = conn.counters.sent
+		data["bytes_received"] = conn.counters.received
+		info.DataSize = int64(conn.counters.sent + conn.counters.received)
+	}
+	data["network"] = info
+
+	return &events.Event{
+		SchemaVersion: events.CurrentSchemaVersion,
+		ID:            fmt.Sprintf("net_%s_%s_%d", connectionClose, conn.info.Protocol, now.UnixNano()),
+		Type:          events.EventTypeNetwork,
+		Timestamp:     now,
+		Source:        "network_collector",
+		Data:          data,
+	}
+}
+
+// listenEvent 创建监听套接字的事件
+func (nc *NetworkCollector) listenEvent(socket *procfs.Socket, info events.NetworkInfo) *events.Event {
+	now := time.Now()
+	return &events.Event{
+		SchemaVersion: events.CurrentSchemaVersion,
+		ID:            fmt.Sprintf("net_listen_%s_%d_%d", socket.Protocol, socket.LocalPort, now.UnixNano()),
+		Type:          events.EventTypeNetwork,
+		Timestamp:     now,
+		Source:        "network_collector",
+		Data: map[string]interface{}{
+			"action":  "listen",
+			"network": info,
+		},
+	}
+}
+
+// rawEvent 创建 raw 套接字的事件，ip_protocol 为它接收的 IP 协议号
+func (nc *NetworkCollector) rawEvent(socket *procfs.Socket, info events.NetworkInfo) *events.Event {
+	now := time.Now()
+	return &events.Event{
+		SchemaVersion: events.CurrentSchemaVersion,
+		ID:            fmt.Sprintf("net_raw_%s_%d_%d", socket.Protocol, socket.LocalPort, now.UnixNano()),
+		Type:          events.EventTypeNetwork,
+		Timestamp:     now,
+		Source:        "network_collector",
+		Data: map[string]interface{}{
+			"action":      "raw",
+			"ip_protocol": socket.LocalPort,
+			"network":     info,
+		},
+	}
+}
+
+// isSuspiciousConnection 检查是否为可疑连接，ip 为对端地址，port 为被连接一方的服务端口
+func (nc *NetworkCollector) isSuspiciousConnection(ip string, port int) bool {
+	// 检查可疑端口
+	suspiciousPorts := []int{22, 23, 3389, 4444, 5555, 6666, 7777, 8888, 9999}
+	for _, suspPort := range suspiciousPorts {
+		if port == suspPort {
+			return true
+		}
+	}
+
+	// 检查私有 IP 范围外的连接
+	return !nc.isPrivateIP(ip)
+}
+
+// isPrivateIP 检查是否为私有、回环、链路本地或未指定地址
+func (nc *NetworkCollector) isPrivateIP(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	return parsed.IsPrivate() || parsed.IsLoopback() || parsed.IsLinkLocalUnicast() || parsed.IsUnspecified()
+}
@@ -0,0 +1,158 @@
+//go:build linux
+
+package collector
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// netlink sock_diag 常量，见 linux/sock_diag.h 和 linux/inet_diag.h
+const (
+	sockDiagByFamily = 20
+	inetDiagInfo     = 2
+
+	// sizeofInetDiagReqV2 struct inet_diag_req_v2 的大小
+	sizeofInetDiagReqV2 = 56
+	// sizeofInetDiagMsg struct inet_diag_msg 的大小
+	sizeofInetDiagMsg = 72
+	// inetDiagMsgInode inet_diag_msg 中 idiag_inode 的偏移
+	inetDiagMsgInode = 68
+
+	// struct tcp_info 中 tcpi_bytes_acked 和 tcpi_bytes_received 的偏移，Linux 4.1 起提供
+	tcpInfoBytesAcked    = 120
+	tcpInfoBytesReceived = 128
+)
+
+// readTCPCounters 通过 sock_diag 读取所有 TCP 套接字的字节计数，按套接字 inode 索引
+//
+// 不需要特殊权限，但只包含仍属于进程的套接字；内核较老时返回空结果。
+func readTCPCounters() (map[uint64]tcpCounters, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, unix.NETLINK_SOCK_DIAG)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sock_diag socket: %w", err)
+	}
+	defer unix.Close(fd)
+
+	counters := make(map[uint64]tcpCounters)
+	buf := make([]byte, 32*1024)
+	for _, family := range []uint8{unix.AF_INET, unix.AF_INET6} {
+		if err := sendTCPDiagRequest(fd, family); err != nil {
+			return nil, fmt.Errorf("failed to request TCP socket info: %w", err)
+		}
+		if err := receiveTCPDiag(fd, buf, counters); err != nil {
+			return nil, err
+		}
+	}
+
+	return counters, nil
+}
+
+// sendTCPDiagRequest 请求导出一个地址族的所有 TCP 套接字及其 tcp_info
+func sendTCPDiagRequest(fd int, family uint8) error {
+	msg := make([]byte, unix.SizeofNlMsghdr+sizeofInetDiagReqV2)
+	order := binary.NativeEndian
+
+	// struct nlmsghdr
+	order.PutUint32(msg[0:], uint32(len(msg)))
+	order.PutUint16(msg[4:], sockDiagByFamily)
+	order.PutUint16(msg[6:], unix.NLM_F_REQUEST|unix.NLM_F_DUMP)
+
+	// struct inet_diag_req_v2，sockid 全为 0 表示不过滤
+	req := msg[unix.SizeofNlMsghdr:]
+	req[0] = family
+	req[1] = unix.IPPROTO_TCP
+	req[2] = 1 << (inetDiagInfo - 1)
+	order.PutUint32(req[4:], 0xFFFFFFFF) // 所有状态
+
+	return unix.Sendto(fd, msg, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK})
+}
+
+// receiveTCPDiag 接收导出结果直到 NLMSG_DONE，记录每个套接字的字节计数
+func receiveTCPDiag(fd int, buf []byte, counters map[uint64]tcpCounters) error {
+	order := binary.NativeEndian
+
+	for {
+		n, _, err := unix.Recvfrom(fd, buf, 0)
+		if err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			return fmt.Errorf("failed to receive TCP socket info: %w", err)
+		}
+
+		data := buf[:n]
+		for len(data) >= unix.SizeofNlMsghdr {
+			length := int(order.Uint32(data[0:]))
+			if length < unix.SizeofNlMsghdr || length > len(data) {
+				break
+			}
+			msgType := order.Uint16(data[4:])
+			payload := data[unix.SizeofNlMsghdr:length]
+
+			switch msgType {
+			case unix.NLMSG_DONE:
+				return nil
+			case unix.NLMSG_ERROR:
+				if len(payload) >= 4 {
+					if errno := int32(order.Uint32(payload[0:])); errno != 0 {
+						return fmt.Errorf("failed to dump TCP sockets: %w", unix.Errno(-errno))
+					}
+				}
+				return nil
+			case sockDiagByFamily:
+				if inode, c, ok := parseTCPDiag(payload); ok {
+					counters[inode] = c
+				}
+			}
+
+			aligned := (length + unix.NLMSG_ALIGNTO - 1) &^ (unix.NLMSG_ALIGNTO - 1)
+			if aligned > len(data) {
+				break
+			}
+			data = data[aligned:]
+		}
+	}
+}
+
+// parseTCPDiag 解析 struct inet_diag_msg 及其后的 INET_DIAG_INFO 属性
+func parseTCPDiag(payload []byte) (uint64, tcpCounters, bool) {
+	order := binary.NativeEndian
+	if len(payload) < sizeofInetDiagMsg {
+		return 0, tcpCounters{}, false
+	}
+	inode := uint64(order.Uint32(payload[inetDiagMsgInode:]))
+	if inode == 0 {
+		return 0, tcpCounters{}, false
+	}
+
+	// struct rtattr 列表
+	attrs := payload[sizeofInetDiagMsg:]
+	for len(attrs) >= unix.SizeofRtAttr {
+		length := int(order.Uint16(attrs[0:]))
+		attrType := order.Uint16(attrs[2:])
+		if length < unix.SizeofRtAttr || length > len(attrs) {
+			break
+		}
+		if attrType == inetDiagInfo {
+			info := attrs[unix.SizeofRtAttr:length]
+			if len(info) < tcpInfoBytesReceived+8 {
+				return 0, tcpCounters{}, false
+			}
+			return inode, tcpCounters{
+				sent:     order.Uint64(info[tcpInfoBytesAcked:]),
+				received: order.Uint64(info[tcpInfoBytesReceived:]),
+			}, true
+		}
+
+		aligned := (length + unix.RTA_ALIGNTO - 1) &^ (unix.RTA_ALIGNTO - 1)
+		if aligned > len(attrs) {
+			break
+		}
+		attrs = attrs[aligned:]
+	}
+
+	return 0, tcpCounters{}, false
+}
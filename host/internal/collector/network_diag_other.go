@@ -0,0 +1,10 @@
+//go:build !linux
+
+package collector
+
+import "errors"
+
+// readTCPCounters 非 Linux 平台不支持 sock_diag，关闭事件中没有字节计数
+func readTCPCounters() (map[uint64]tcpCounters, error) {
+	return nil, errors.New("sock_diag is only available on Linux")
+}
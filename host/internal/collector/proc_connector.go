@@ -0,0 +1,141 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/wasm-threat-detector/host/internal/events"
+)
+
+// 进程连接器事件类型，见 linux/cn_proc.h
+const (
+	procEventFork = 0x00000001
+	procEventExec = 0x00000002
+	procEventUID  = 0x00000004
+	procEventExit = 0x80000000
+)
+
+// errProcEventsLost 套接字接收缓冲区溢出，内核丢弃了部分进程事件
+var errProcEventsLost = errors.New("process connector receive buffer overflowed, events were lost")
+
+// procEvent 进程连接器上报的事件
+type procEvent struct {
+	what       uint32
+	pid        int32 // 线程 ID
+	tgid       int32 // 进程 ID
+	parentPID  int32 // fork：父线程 ID
+	parentTGID int32 // fork：父进程 ID
+	ruid       uint32
+	euid       uint32
+	exitCode   uint32 // exit：wait 状态，低 7 位为终止信号，高 8 位为退出码
+}
+
+// monitorProcConnector 从 netlink 进程连接器接收 exec/fork/exit/uid 事件
+func (pc *ProcessCollector) monitorProcConnector(ctx context.Context, conn *procConnector) {
+	defer conn.close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-pc.done:
+			return
+		default:
+		}
+
+		procEvents, err := conn.receive()
+		if errors.Is(err, errProcEventsLost) {
+			pc.logger.Warn("Process events were lost, rescanning processes")
+			pc.rescan()
+			continue
+		}
+		if err != nil {
+			pc.logger.Warnf("Failed to receive process events: %v", err)
+			continue
+		}
+
+		for _, pe := range procEvents {
+			if event := pc.procConnectorEvent(pe); event != nil {
+				pc.send(event)
+			}
+		}
+	}
+}
+
+// rescan 丢失事件后重新扫描进程列表，上报与进程表相比新建和退出的进程
+func (pc *ProcessCollector) rescan() {
+	known := make(map[int32]uint64)
+	for _, proc := range pc.table.Processes() {
+		known[proc.PID] = proc.StartTime
+	}
+	if _, err := pc.scanProcesses(known); err != nil {
+		pc.logger.Warnf("Failed to get process list: %v", err)
+	}
+}
+
+// procConnectorEvent 将进程连接器事件转换为进程事件，线程事件返回 nil
+func (pc *ProcessCollector) procConnectorEvent(pe procEvent) *events.Event {
+	// 只关注进程（线程组组长），忽略线程的创建和退出
+	if pe.pid != pe.tgid {
+		return nil
+	}
+
+	now := time.Now()
+	data := map[string]interface{}{}
+	var action string
+
+	switch pe.what {
+	case procEventExec:
+		action = "exec"
+	case procEventFork:
+		action = "fork"
+	case procEventUID:
+		action = "uid_change"
+		data["ruid"] = pe.ruid
+		data["euid"] = pe.euid
+	case procEventExit:
+		action = "exit"
+		data["exit_signal"] = int(pe.exitCode & 0x7f)
+	default:
+		return nil
+	}
+
+	// 短命进程在读取 /proc 之前可能已经退出，此时只上报内核提供的 PID
+	var proc *events.ProcessInfo
+	if pe.what == procEventExit {
+		if exited, ok := pc.table.Exit(pe.tgid, now, int(pe.exitCode>>8)&0xff); ok {
+			proc = pc.describe(exited)
+			addLifetime(data, exited)
+		} else {
+			data["exit_time"] = now
+			data["exit_code"] = int(pe.exitCode>>8) & 0xff
+		}
+	} else if p, err := pc.proc.ReadProcess(pe.tgid); err == nil {
+		// 父进程可能在读取 /proc 之前已经退出，子进程已被收养，以内核上报的父进程为准
+		if pe.what == procEventFork {
+			p.PPID = pe.parentTGID
+		}
+		pc.table.Add(p)
+		proc = pc.describe(p)
+	}
+	if proc == nil {
+		proc = &events.ProcessInfo{PID: pe.tgid}
+		if pe.what == procEventFork {
+			proc.PPID = pe.parentTGID
+		}
+	}
+
+	data["action"] = action
+	data["process"] = proc
+
+	return &events.Event{
+		SchemaVersion: events.CurrentSchemaVersion,
+		ID:            fmt.Sprintf("proc_%s_%d_%d", action, pe.tgid, now.UnixNano()),
+		Type:          events.EventTypeProcess,
+		Timestamp:     now,
+		Source:        "proc_connector",
+		Data:          data,
+	}
+}
@@ -0,0 +1,214 @@
+//go:build linux
+
+package collector
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// netlink 进程连接器常量，见 linux/connector.h 和 linux/cn_proc.h
+const (
+	cnIdxProc = 1
+	cnValProc = 1
+
+	procCnMcastListen = 1
+	procCnMcastIgnore = 2
+
+	// sizeofCnMsg struct cn_msg 的大小（不含数据）
+	sizeofCnMsg = 20
+	// sizeofProcEventHeader struct proc_event 中 what、cpu、timestamp_ns 的大小
+	sizeofProcEventHeader = 16
+)
+
+// procConnectorReadTimeout 接收超时，用于定期检查收集器是否已停止
+const procConnectorReadTimeout = time.Second
+
+// procConnectorProbeTimeout 订阅后等待第一个事件的时间
+const procConnectorProbeTimeout = 3 * time.Second
+
+// procConnector 订阅内核进程事件的 netlink 套接字
+type procConnector struct {
+	fd      int
+	buf     []byte
+	pending []procEvent // 探测期间收到的事件，由下一次 receive 返回
+}
+
+// openProcConnector 打开 netlink 进程连接器并订阅事件，需要 CAP_NET_ADMIN
+//
+// 不在初始网络命名空间（例如容器内）时订阅会成功但收不到任何事件，因此订阅后确认能收到事件。
+func openProcConnector() (*procConnector, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, unix.NETLINK_CONNECTOR)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create netlink connector socket: %w", err)
+	}
+
+	addr := &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: cnIdxProc}
+	if err := unix.Bind(fd, addr); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("failed to bind netlink connector socket: %w", err)
+	}
+
+	tv := unix.NsecToTimeval(procConnectorReadTimeout.Nanoseconds())
+	if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("failed to set netlink connector timeout: %w", err)
+	}
+
+	conn := &procConnector{fd: fd, buf: make([]byte, 16*1024)}
+	if err := conn.control(procCnMcastListen); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("failed to subscribe to process events: %w", err)
+	}
+	if err := conn.probe(); err != nil {
+		conn.close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// probe 创建一个立即退出的子进程，并等待收到任意进程事件
+func (c *procConnector) probe() error {
+	// 即使 exec 失败，子进程也已经创建并退出，同样会产生 fork 和 exit 事件
+	if pid, err := syscall.ForkExec("/bin/true", []string{"true"}, &syscall.ProcAttr{}); err == nil {
+		syscall.Wait4(pid, nil, 0, nil)
+	}
+
+	deadline := time.Now().Add(procConnectorProbeTimeout)
+	for time.Now().Before(deadline) {
+		procEvents, err := c.receive()
+		if errors.Is(err, errProcEventsLost) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to receive process events: %w", err)
+		}
+		if len(procEvents) > 0 {
+			c.pending = procEvents
+			return nil
+		}
+	}
+
+	return fmt.Errorf("no process events received within %s (not in the initial network namespace?)", procConnectorProbeTimeout)
+}
+
+// control 发送订阅或取消订阅消息
+func (c *procConnector) control(op uint32) error {
+	msg := make([]byte, unix.SizeofNlMsghdr+sizeofCnMsg+4)
+	order := binary.NativeEndian
+
+	// struct nlmsghdr
+	order.PutUint32(msg[0:], uint32(len(msg)))
+	order.PutUint16(msg[4:], unix.NLMSG_DONE)
+	order.PutUint32(msg[12:], uint32(unix.Getpid()))
+
+	// struct cn_msg
+	cn := msg[unix.SizeofNlMsghdr:]
+	order.PutUint32(cn[0:], cnIdxProc)
+	order.PutUint32(cn[4:], cnValProc)
+	order.PutUint16(cn[16:], 4)
+
+	// enum proc_cn_mcast_op
+	order.PutUint32(cn[sizeofCnMsg:], op)
+
+	return unix.Sendto(c.fd, msg, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK})
+}
+
+// receive 接收一批进程事件，超时时返回空列表，接收缓冲区溢出时返回 errProcEventsLost
+func (c *procConnector) receive() ([]procEvent, error) {
+	if pending := c.pending; pending != nil {
+		c.pending = nil
+		return pending, nil
+	}
+
+	n, _, err := unix.Recvfrom(c.fd, c.buf, 0)
+	if err != nil {
+		switch err {
+		case unix.EAGAIN, unix.EINTR:
+			return nil, nil
+		case unix.ENOBUFS:
+			return nil, errProcEventsLost
+		}
+		return nil, err
+	}
+
+	return parseProcEvents(c.buf[:n]), nil
+}
+
+// close 取消订阅并关闭套接字
+func (c *procConnector) close() error {
+	c.control(procCnMcastIgnore)
+	return unix.Close(c.fd)
+}
+
+// parseProcEvents 解析 netlink 消息中的进程事件，忽略不认识的事件
+func parseProcEvents(data []byte) []procEvent {
+	order := binary.NativeEndian
+	var result []procEvent
+
+	for len(data) >= unix.SizeofNlMsghdr {
+		length := int(order.Uint32(data[0:]))
+		if length < unix.SizeofNlMsghdr || length > len(data) {
+			break
+		}
+		msgType := order.Uint16(data[4:])
+		payload := data[unix.SizeofNlMsghdr:length]
+
+		if msgType != unix.NLMSG_ERROR && msgType != unix.NLMSG_NOOP &&
+			len(payload) >= sizeofCnMsg+sizeofProcEventHeader &&
+			order.Uint32(payload[0:]) == cnIdxProc && order.Uint32(payload[4:]) == cnValProc {
+			if event, ok := parseProcEvent(payload[sizeofCnMsg:]); ok {
+				result = append(result, event)
+			}
+		}
+
+		// 消息按 4 字节对齐
+		aligned := (length + unix.NLMSG_ALIGNTO - 1) &^ (unix.NLMSG_ALIGNTO - 1)
+		if aligned > len(data) {
+			break
+		}
+		data = data[aligned:]
+	}
+
+	return result
+}
+
+// parseProcEvent 解析 struct proc_event
+func parseProcEvent(data []byte) (procEvent, bool) {
+	order := binary.NativeEndian
+	event := procEvent{what: order.Uint32(data[0:])}
+	body := data[sizeofProcEventHeader:]
+
+	u32 := func(i int) uint32 { return order.Uint32(body[i*4:]) }
+	need := map[uint32]int{
+		procEventFork: 4,
+		procEventExec: 2,
+		procEventUID:  4,
+		procEventExit: 3,
+	}[event.what]
+	if need == 0 || len(body) < need*4 {
+		return event, false
+	}
+
+	switch event.what {
+	case procEventFork:
+		event.parentPID, event.parentTGID = int32(u32(0)), int32(u32(1))
+		event.pid, event.tgid = int32(u32(2)), int32(u32(3))
+	case procEventExec:
+		event.pid, event.tgid = int32(u32(0)), int32(u32(1))
+	case procEventUID:
+		event.pid, event.tgid = int32(u32(0)), int32(u32(1))
+		event.ruid, event.euid = u32(2), u32(3)
+	case procEventExit:
+		event.pid, event.tgid = int32(u32(0)), int32(u32(1))
+		event.exitCode = u32(2)
+	}
+
+	return event, true
+}
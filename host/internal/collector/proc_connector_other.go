@@ -0,0 +1,23 @@
+//go:build !linux
+
+package collector
+
+import "errors"
+
+// procConnector 非 Linux 平台不支持进程连接器
+type procConnector struct{}
+
+// openProcConnector 非 Linux 平台始终返回错误，收集器回退到轮询
+func openProcConnector() (*procConnector, error) {
+	return nil, errors.New("netlink process connector is only available on Linux")
+}
+
+// receive 非 Linux 平台不会被调用
+func (c *procConnector) receive() ([]procEvent, error) {
+	return nil, nil
+}
+
+// close 非 Linux 平台不会被调用
+func (c *procConnector) close() error {
+	return nil
+}
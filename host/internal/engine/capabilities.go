@@ -0,0 +1,143 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/bytecodealliance/wasmtime-go/v17"
+)
+
+// wasiModule WASI 导入模块名
+const wasiModule = "wasi_snapshot_preview1"
+
+// wasiCapability WASI 函数所需的能力
+type wasiCapability int
+
+const (
+	capBase wasiCapability = iota // 所有规则都可以使用
+	capClock
+	capDirs   // 预打开目录，无法只读授予，目前不授予任何规则
+	capDenied // 任何规则都不会被授予
+)
+
+// wasiFunctions WASI 函数到所需能力的映射
+//
+// 修改文件系统的函数一律拒绝，未列出的函数同样拒绝。访问预打开目录的函数目前不会授予任何规则：
+// wasmtime 的 PreopenDir 没有权限参数，path_open 可以创建或截断文件，无法只读授予目录。
+var wasiFunctions = map[string]wasiCapability{
+	"args_get":            capBase,
+	"args_sizes_get":      capBase,
+	"environ_get":         capBase,
+	"environ_sizes_get":   capBase,
+	"fd_close":            capBase,
+	"fd_fdstat_get":       capBase,
+	"fd_prestat_get":      capBase,
+	"fd_prestat_dir_name": capBase,
+	"fd_read":             capBase,
+	"fd_seek":             capBase,
+	"fd_write":            capBase,
+	"proc_exit":           capBase,
+	"random_get":          capBase,
+	"sched_yield":         capBase,
+
+	"clock_res_get":  capClock,
+	"clock_time_get": capClock,
+	"poll_oneoff":    capClock,
+
+	"fd_advise":           capDirs,
+	"fd_datasync":         capDirs,
+	"fd_fdstat_set_flags": capDirs,
+	"fd_filestat_get":     capDirs,
+	"fd_pread":            capDirs,
+	"fd_readdir":          capDirs,
+	"fd_renumber":         capDirs,
+	"fd_sync":             capDirs,
+	"fd_tell":             capDirs,
+	"path_filestat_get":   capDirs,
+	"path_open":           capDirs,
+	"path_readlink":       capDirs,
+
+	"fd_allocate":             capDenied,
+	"fd_filestat_set_size":    capDenied,
+	"fd_filestat_set_times":   capDenied,
+	"fd_pwrite":               capDenied,
+	"path_create_directory":   capDenied,
+	"path_filestat_set_times": capDenied,
+	"path_link":               capDenied,
+	"path_remove_directory":   capDenied,
+	"path_rename":             capDenied,
+	"path_symlink":            capDenied,
+	"path_unlink_file":        capDenied,
+	"sock_accept":             capDenied,
+	"sock_recv":               capDenied,
+	"sock_send":               capDenied,
+	"sock_shutdown":           capDenied,
+}
+
+// granted 判断能力是否已在清单中声明
+func (c Capabilities) granted(capability wasiCapability) bool {
+	switch capability {
+	case capBase:
+		return true
+	case capClock:
+		return c.Clock
+	default:
+		return false
+	}
+}
+
+// CheckCapabilities 检查清单声明的能力是否支持，以及模块导入的 WASI 函数是否都已被授予
+func (info *ModuleInfo) CheckCapabilities(manifest *RuleManifest) error {
+	if len(manifest.Capabilities.Dirs) > 0 {
+		return fmt.Errorf("capabilities.dirs is not supported: the WASI runtime cannot preopen directories read-only")
+	}
+
+	var denied []string
+	for _, imp := range info.Imports {
+		if imp.Module != wasiModule {
+			continue
+		}
+
+		capability, known := wasiFunctions[imp.Name]
+		if !known || !manifest.Capabilities.granted(capability) {
+			denied = append(denied, imp.Name)
+		}
+	}
+
+	if len(denied) > 0 {
+		sort.Strings(denied)
+		return fmt.Errorf("module imports WASI functions that were not granted: %s", strings.Join(denied, ", "))
+	}
+
+	return nil
+}
+
+// newRuleWasiConfig 按清单声明的能力创建 WASI 配置，并重定向规则输出
+func newRuleWasiConfig(manifest *RuleManifest, output *ruleOutput) (*wasmtime.WasiConfig, error) {
+	wasiConfig := wasmtime.NewWasiConfig()
+
+	if err := output.configure(wasiConfig); err != nil {
+		return nil, err
+	}
+
+	caps := manifest.Capabilities
+
+	// 环境变量
+	if len(caps.Env) > 0 {
+		keys := make([]string, 0, len(caps.Env))
+		values := make([]string, 0, len(caps.Env))
+		for _, env := range caps.Env {
+			name, value, fixed := strings.Cut(env, "=")
+			if !fixed {
+				value = os.Getenv(name)
+			}
+			keys = append(keys, name)
+			values = append(values, value)
+		}
+		wasiConfig.SetEnv(keys, values)
+	}
+
+	return wasiConfig, nil
+}
@@ -0,0 +1,294 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wasm-threat-detector/host/internal/events"
+)
+
+// maxDivergenceSamples 每个规则在一个报告周期内保留的分歧样本数
+const maxDivergenceSamples = 10
+
+// 分歧类型
+const (
+	DivergenceOnlyBaseline     = "only_baseline"     // 只有当前版本触发
+	DivergenceOnlyCandidate    = "only_candidate"    // 只有候选版本触发
+	DivergenceSeverityMismatch = "severity_mismatch" // 都触发但严重程度不同
+)
+
+// CompareConfig A/B 比较配置
+type CompareConfig struct {
+	ReportInterval time.Duration     `mapstructure:"report_interval"` // 分歧报告周期
+	Rules          map[string]string `mapstructure:"rules"`           // 规则名 -> 候选版本 Wasm 文件
+}
+
+// DivergenceReport 一个报告周期内的分歧统计
+type DivergenceReport struct {
+	Start time.Time
+	End   time.Time
+	Rules map[string]*RuleDivergence
+}
+
+// RuleDivergence 单个规则两个版本的比较结果
+type RuleDivergence struct {
+	Events           uint64 // 比较的事件数
+	Agreed           uint64 // 两个版本结果一致的事件数
+	OnlyBaseline     uint64
+	OnlyCandidate    uint64
+	SeverityMismatch uint64
+	Samples          []DivergenceSample
+}
+
+// DivergenceSample 分歧样本
+type DivergenceSample struct {
+	EventID           string           `json:"event_id"`
+	EventType         events.EventType `json:"event_type"`
+	SubRuleID         string           `json:"sub_rule_id,omitempty"`
+	Kind              string           `json:"kind"`
+	BaselineSeverity  string           `json:"baseline_severity,omitempty"`
+	CandidateSeverity string           `json:"candidate_severity,omitempty"`
+}
+
+// ComparisonEngine 在当前规则之外运行候选版本，比较两者的检测结果
+//
+// 只返回当前版本的检测结果，候选版本的结果只用于生成分歧报告，不会重复告警。
+type ComparisonEngine struct {
+	ThreatEngine
+	candidates ThreatEngine
+	report     *DivergenceReport
+	mu         sync.Mutex
+	logger     *logrus.Logger
+}
+
+// NewComparisonEngine 创建比较引擎，baseline 运行当前规则，candidates 运行候选版本
+func NewComparisonEngine(logger *logrus.Logger, baseline, candidates ThreatEngine) *ComparisonEngine {
+	return &ComparisonEngine{
+		ThreatEngine: baseline,
+		candidates:   candidates,
+		report:       newDivergenceReport(time.Now()),
+		logger:       logger,
+	}
+}
+
+// LoadCandidate 加载规则的候选版本，name 与当前版本的规则名相同
+func (c *ComparisonEngine) LoadCandidate(name, wasmPath string) error {
+	if err := c.candidates.LoadRule(name, wasmPath); err != nil {
+		return fmt.Errorf("failed to load candidate for rule %s: %w", name, err)
+	}
+	c.logger.Infof("Comparing rule %s with candidate %s", name, wasmPath)
+	return nil
+}
+
+// DetectThreat 用两个版本检测威胁，返回当前版本的结果
+func (c *ComparisonEngine) DetectThreat(ctx context.Context, event *events.Event) ([]*events.DetectionResult, error) {
+	results, err := c.ThreatEngine.DetectThreat(ctx, event)
+	if err != nil {
+		return nil, err
+	}
+
+	// 候选版本看到的是富化之后的同一个事件
+	candidateResults, err := c.candidates.DetectThreat(ctx, event)
+	if err != nil {
+		c.logger.Warnf("Candidate detection failed: %v", err)
+		return results, nil
+	}
+
+	c.compare(event, results, candidateResults)
+	return results, nil
+}
+
+// Tick 调用两个版本的 tick 钩子，返回当前版本的结果
+func (c *ComparisonEngine) Tick(ctx context.Context, now time.Time) ([]*events.DetectionResult, error) {
+	results, err := c.ThreatEngine.Tick(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+
+	candidateResults, err := c.candidates.Tick(ctx, now)
+	if err != nil {
+		c.logger.Warnf("Candidate tick failed: %v", err)
+		return results, nil
+	}
+
+	// tick 结果按规则比较，两个版本都没有结果的 tick 不计入报告
+	for _, name := range c.candidates.GetLoadedRules() {
+		baseline, candidate := filterResults(results, name), filterResults(candidateResults, name)
+		if len(baseline) == 0 && len(candidate) == 0 {
+			continue
+		}
+		c.compareRule(name, newTickEvent(name, now), baseline, candidate)
+	}
+
+	return results, nil
+}
+
+// compare 比较每个有候选版本的规则在同一事件上的结果
+func (c *ComparisonEngine) compare(event *events.Event, baseline, candidate []*events.DetectionResult) {
+	for _, name := range c.candidates.GetLoadedRules() {
+		c.compareRule(name, event, filterResults(baseline, name), filterResults(candidate, name))
+	}
+}
+
+// compareRule 比较单个规则两个版本的结果，按子规则 ID 对应
+func (c *ComparisonEngine) compareRule(name string, event *events.Event, baseline, candidate []*events.DetectionResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rd := c.report.rule(name)
+	rd.Events++
+
+	baselineBySub := severityBySubRule(baseline)
+	candidateBySub := severityBySubRule(candidate)
+
+	diverged := false
+	for sub, severity := range baselineBySub {
+		other, ok := candidateBySub[sub]
+		switch {
+		case !ok:
+			rd.OnlyBaseline++
+			rd.sample(event, sub, DivergenceOnlyBaseline, severity, "")
+			diverged = true
+		case other != severity:
+			rd.SeverityMismatch++
+			rd.sample(event, sub, DivergenceSeverityMismatch, severity, other)
+			diverged = true
+		}
+	}
+	for sub, severity := range candidateBySub {
+		if _, ok := baselineBySub[sub]; !ok {
+			rd.OnlyCandidate++
+			rd.sample(event, sub, DivergenceOnlyCandidate, "", severity)
+			diverged = true
+		}
+	}
+
+	if !diverged {
+		rd.Agreed++
+	}
+}
+
+// Report 返回当前周期的分歧报告并开始新的周期
+func (c *ComparisonEngine) Report() *DivergenceReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	report := c.report
+	report.End = now
+	c.report = newDivergenceReport(now)
+
+	return report
+}
+
+// LogReport 生成分歧报告并写入日志
+func (c *ComparisonEngine) LogReport() {
+	report := c.Report()
+
+	names := make([]string, 0, len(report.Rules))
+	for name := range report.Rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		rd := report.Rules[name]
+		fields := logrus.Fields{
+			"rule":              name,
+			"period_start":      report.Start.Format(time.RFC3339),
+			"period_end":        report.End.Format(time.RFC3339),
+			"events":            rd.Events,
+			"agreed":            rd.Agreed,
+			"only_baseline":     rd.OnlyBaseline,
+			"only_candidate":    rd.OnlyCandidate,
+			"severity_mismatch": rd.SeverityMismatch,
+		}
+		if len(rd.Samples) > 0 {
+			fields["samples"] = rd.Samples
+		}
+
+		entry := c.logger.WithFields(fields)
+		if rd.Events > rd.Agreed {
+			entry.Warnf("Rule %s candidate diverged on %d of %d events", name, rd.Events-rd.Agreed, rd.Events)
+		} else {
+			entry.Infof("Rule %s candidate agreed on all %d events", name, rd.Events)
+		}
+	}
+}
+
+// Stats 返回两个版本的调用统计，候选版本的类型标记为 candidate
+func (c *ComparisonEngine) Stats() []RuleStats {
+	stats := c.ThreatEngine.Stats()
+	for _, s := range c.candidates.Stats() {
+		s.Kind = "candidate"
+		stats = append(stats, s)
+	}
+	return sortStats(stats)
+}
+
+// Close 关闭两个引擎
+func (c *ComparisonEngine) Close() error {
+	if err := c.candidates.Close(); err != nil {
+		c.logger.Warnf("Failed to close candidate engine: %v", err)
+	}
+	return c.ThreatEngine.Close()
+}
+
+// newDivergenceReport 创建空的分歧报告
+func newDivergenceReport(start time.Time) *DivergenceReport {
+	return &DivergenceReport{
+		Start: start,
+		Rules: make(map[string]*RuleDivergence),
+	}
+}
+
+// rule 获取规则的比较结果，不存在时创建
+func (r *DivergenceReport) rule(name string) *RuleDivergence {
+	rd, ok := r.Rules[name]
+	if !ok {
+		rd = &RuleDivergence{}
+		r.Rules[name] = rd
+	}
+	return rd
+}
+
+// sample 记录分歧样本，超过上限后只计数
+func (rd *RuleDivergence) sample(event *events.Event, sub, kind, baseline, candidate string) {
+	if len(rd.Samples) >= maxDivergenceSamples {
+		return
+	}
+	rd.Samples = append(rd.Samples, DivergenceSample{
+		EventID:           event.ID,
+		EventType:         event.Type,
+		SubRuleID:         sub,
+		Kind:              kind,
+		BaselineSeverity:  baseline,
+		CandidateSeverity: candidate,
+	})
+}
+
+// filterResults 返回指定规则的检测结果
+func filterResults(results []*events.DetectionResult, name string) []*events.DetectionResult {
+	var filtered []*events.DetectionResult
+	for _, result := range results {
+		if result.RuleName == name {
+			filtered = append(filtered, result)
+		}
+	}
+	return filtered
+}
+
+// severityBySubRule 按子规则 ID 索引检测结果的严重程度，同一子规则取最高的严重程度
+func severityBySubRule(results []*events.DetectionResult) map[string]string {
+	bySub := make(map[string]string, len(results))
+	for _, result := range results {
+		if current, ok := bySub[result.SubRuleID]; !ok || severityRank(result.Severity) > severityRank(current) {
+			bySub[result.SubRuleID] = result.Severity
+		}
+	}
+	return bySub
+}
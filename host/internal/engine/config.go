@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"fmt"
+	"time"
+)
+
+// Config 引擎配置
+type Config struct {
+	RuleOutput   RuleOutputConfig
+	Scoring      ScoringConfig
+	Filters      FilterConfig
+	Rules        map[string]RuleConfig
+	TickInterval time.Duration // 调用规则 tick 钩子的周期
+	MaxMemoryMB  int           // 每个规则实例的最大线性内存（MiB），<= 0 表示只受模块声明的限制
+	Trace        TraceConfig
+}
+
+// RuleOutputConfig 规则 stdout/stderr 转发配置
+type RuleOutputConfig struct {
+	MaxLines int           `mapstructure:"max_lines"` // 每个时间窗口内单个规则最多转发的行数，<= 0 表示不限制
+	Interval time.Duration `mapstructure:"interval"`  // 限流时间窗口
+}
+
+// RuleConfig 单个规则的配置
+type RuleConfig struct {
+	DiscardOutput bool           `mapstructure:"discard_output"` // 丢弃规则的 stdout/stderr
+	Threshold     int32          `mapstructure:"threshold"`      // 覆盖 filters.min_threat_level
+	MinSeverity   string         `mapstructure:"min_severity"`   // 覆盖 filters.min_severity
+	Scoring       *ScoringConfig `mapstructure:"scoring"`        // 覆盖全局严重程度和置信度映射
+}
+
+// DefaultConfig 返回默认引擎配置
+func DefaultConfig() Config {
+	return Config{
+		RuleOutput: RuleOutputConfig{
+			MaxLines: 20,
+			Interval: time.Second,
+		},
+		Scoring:      DefaultScoringConfig(),
+		Rules:        make(map[string]RuleConfig),
+		TickInterval: 10 * time.Second,
+		MaxMemoryMB:  64,
+	}
+}
+
+// maxMemoryBytes 返回规则实例的最大线性内存字节数，-1 表示不限制
+func (c Config) maxMemoryBytes() int64 {
+	if c.MaxMemoryMB <= 0 {
+		return -1
+	}
+	return int64(c.MaxMemoryMB) << 20
+}
+
+// ruleConfig 获取指定规则的配置
+func (c Config) ruleConfig(name string) RuleConfig {
+	return c.Rules[name]
+}
+
+// Validate 校验全局和各规则的配置
+func (c Config) Validate() error {
+	if _, err := newRuleScoring(c, ""); err != nil {
+		return err
+	}
+
+	for name := range c.Rules {
+		if _, err := newRuleScoring(c, name); err != nil {
+			return err
+		}
+	}
+
+	if c.RuleOutput.MaxLines > 0 && c.RuleOutput.Interval <= 0 {
+		return fmt.Errorf("rule_output.interval must be positive when max_lines is set")
+	}
+
+	if c.TickInterval <= 0 {
+		return fmt.Errorf("tick_interval must be positive")
+	}
+
+	if err := c.Trace.Events.validate(); err != nil {
+		return fmt.Errorf("trace.events: %w", err)
+	}
+
+	return nil
+}
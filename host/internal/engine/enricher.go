@@ -0,0 +1,317 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/bytecodealliance/wasmtime-go/v17"
+	"github.com/sirupsen/logrus"
+)
+
+// enrichmentsKey 富化结果在 Event.Data 中的键，每个富化规则的输出位于 enrichments.<规则名>
+const enrichmentsKey = "enrichments"
+
+// enricher 富化规则，在检测规则之前为事件补充字段
+//
+// 富化规则导出 enrich(ptr, len) -> i32，把 JSON 对象写入 result_ptr() 指向的内存并返回其长度，
+// 返回 0 表示没有补充内容。
+type enricher struct {
+	name          string
+	order         int
+	manifest      *RuleManifest
+	store         *wasmtime.Store
+	memory        *wasmtime.Memory
+	enrich        *wasmtime.Func
+	resultPtr     *wasmtime.Func
+	payload       *payloadBuffer
+	init          *wasmtime.Func
+	shutdown      *wasmtime.Func
+	prefilter     *prefilter
+	projection    *projection
+	schemaVersion int // 发送给规则的事件结构版本
+	counters      *ruleCounters
+	output        *ruleOutput
+	mu            sync.Mutex
+}
+
+// newEnricher 实例化富化规则并调用 init 钩子
+func newEnricher(engine *wasmtime.Engine, config Config, name string, module *wasmtime.Module, manifest *RuleManifest, output *ruleOutput) (*enricher, error) {
+	schemaVersion, err := manifest.EventSchemaVersion()
+	if err != nil {
+		return nil, fmt.Errorf("enricher %s: %w", name, err)
+	}
+
+	store := newRuleStore(engine, config)
+
+	linker := wasmtime.NewLinker(engine)
+	if err := linker.DefineWasi(); err != nil {
+		return nil, fmt.Errorf("failed to define WASI: %w", err)
+	}
+
+	// 按清单授予 WASI 能力，规则输出重定向到捕获文件
+	wasiConfig, err := newRuleWasiConfig(manifest, output)
+	if err != nil {
+		return nil, err
+	}
+	store.SetWasi(wasiConfig)
+
+	instance, err := linker.Instantiate(store, module)
+	if err != nil {
+		return nil, fmt.Errorf("failed to instantiate wasm module %s: %w", name, err)
+	}
+	if err := initializeReactor(store, instance); err != nil {
+		return nil, fmt.Errorf("enricher %s: %w", name, err)
+	}
+
+	memoryExport := instance.GetExport(store, "memory")
+	if memoryExport == nil || memoryExport.Memory() == nil {
+		return nil, fmt.Errorf("enricher %s has no memory export", name)
+	}
+
+	counters := &ruleCounters{}
+	en := &enricher{
+		name:          name,
+		order:         manifest.Order,
+		manifest:      manifest,
+		store:         store,
+		memory:        memoryExport.Memory(),
+		enrich:        instance.GetFunc(store, "enrich"),
+		resultPtr:     instance.GetFunc(store, "result_ptr"),
+		payload:       newPayloadBuffer(store, instance, memoryExport.Memory(), counters),
+		init:          instance.GetFunc(store, "init"),
+		shutdown:      instance.GetFunc(store, "shutdown"),
+		prefilter:     newPrefilter(manifest.Prefilter),
+		projection:    newProjection(manifest.Fields),
+		schemaVersion: schemaVersion,
+		counters:      counters,
+		output:        output,
+	}
+	if en.enrich == nil || en.resultPtr == nil {
+		return nil, fmt.Errorf("enricher %s must export 'enrich' and 'result_ptr' functions", name)
+	}
+
+	if en.init != nil {
+		result, err := en.init.Call(store)
+		output.flush("")
+		if err != nil {
+			return nil, fmt.Errorf("failed to call init function in enricher %s: %w", name, err)
+		}
+		code, err := resultLevel(name, result)
+		if err != nil {
+			return nil, err
+		}
+		if code != 0 {
+			return nil, fmt.Errorf("init function in enricher %s returned %d", name, code)
+		}
+	}
+
+	return en, nil
+}
+
+// run 对事件数据执行富化，返回富化规则输出的字段
+//
+// trace 不为 nil 时记录实际写入的负载、燃料消耗、返回值和输出的字段。
+func (en *enricher) run(eventData []byte, eventID string, trace *RuleTrace) (map[string]interface{}, error) {
+	en.mu.Lock()
+	defer en.mu.Unlock()
+	defer en.output.flushTrace(eventID, trace)
+
+	payloadPtr, payload, err := en.payload.write(eventData)
+	if err != nil {
+		return nil, fmt.Errorf("enricher %s: %w", en.name, err)
+	}
+	if trace != nil {
+		trace.Payload = payload
+		trace.Truncated = len(payload) != len(eventData)
+	}
+
+	fuel := startFuel(en.store, trace)
+	result, err := en.enrich.Call(en.store, payloadPtr, int32(len(payload)))
+	fuel.stop(trace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call enrich function in enricher %s: %w", en.name, err)
+	}
+	length, err := resultLevel(en.name, result)
+	if err != nil {
+		return nil, err
+	}
+	if trace != nil {
+		trace.ReturnValue = length
+	}
+	switch {
+	case length == 0:
+		return nil, nil
+	case length < 0 || length > maxFindingsSize:
+		return nil, fmt.Errorf("enricher %s returned invalid result length %d", en.name, length)
+	}
+
+	ptrResult, err := en.resultPtr.Call(en.store)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call result_ptr function in enricher %s: %w", en.name, err)
+	}
+	ptr, err := resultLevel(en.name, ptrResult)
+	if err != nil {
+		return nil, err
+	}
+
+	// 重新获取内存，enrich 可能扩展了内存
+	memoryData := en.memory.UnsafeData(en.store)
+	if ptr < 0 || int(ptr)+int(length) > len(memoryData) {
+		return nil, fmt.Errorf("enricher %s result at %d+%d is out of memory bounds", en.name, ptr, length)
+	}
+
+	data := memoryData[ptr : ptr+length]
+	if trace != nil {
+		trace.Result = append(json.RawMessage(nil), data...)
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("enricher %s returned invalid JSON object: %w", en.name, err)
+	}
+
+	return fields, nil
+}
+
+// close 调用 shutdown 钩子，并删除富化规则的捕获文件
+func (en *enricher) close() error {
+	en.mu.Lock()
+	defer en.mu.Unlock()
+	defer en.output.close()
+
+	if en.shutdown == nil {
+		return nil
+	}
+
+	_, err := en.shutdown.Call(en.store)
+	en.output.flush("")
+	if err != nil {
+		return fmt.Errorf("failed to call shutdown function in enricher %s: %w", en.name, err)
+	}
+
+	return nil
+}
+
+// enricherChain 按顺序执行的富化规则列表
+type enricherChain struct {
+	enrichers []*enricher
+	logger    *logrus.Logger
+}
+
+// newEnricherChain 创建空的富化规则列表
+func newEnricherChain(logger *logrus.Logger) *enricherChain {
+	return &enricherChain{logger: logger}
+}
+
+// add 添加富化规则，替换同名规则，并按 order 和名称排序
+func (c *enricherChain) add(en *enricher) {
+	c.remove(en.name)
+	c.enrichers = append(c.enrichers, en)
+	sort.SliceStable(c.enrichers, func(i, j int) bool {
+		if c.enrichers[i].order != c.enrichers[j].order {
+			return c.enrichers[i].order < c.enrichers[j].order
+		}
+		return c.enrichers[i].name < c.enrichers[j].name
+	})
+}
+
+// remove 移除并关闭富化规则，返回是否存在
+func (c *enricherChain) remove(name string) bool {
+	for i, en := range c.enrichers {
+		if en.name == name {
+			if err := en.close(); err != nil {
+				c.logger.Warnf("Enricher %s shutdown failed: %v", name, err)
+			}
+			c.enrichers = append(c.enrichers[:i], c.enrichers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// names 返回富化规则名称
+func (c *enricherChain) names() []string {
+	var names []string
+	for _, en := range c.enrichers {
+		names = append(names, en.name)
+	}
+	return names
+}
+
+// run 依次执行富化规则，把输出合并到 event.Data["enrichments"][规则名]
+//
+// 后面的富化规则可以看到前面规则的输出。单个富化规则失败只记录警告。
+func (c *enricherChain) run(view *eventView, traces *traceRecorder) error {
+	event := view.event
+
+	for _, en := range c.enrichers {
+		trace := traces.start(en.name, KindEnricher, view)
+
+		// 富化规则看到的是它支持的结构版本，输出按原样合并到当前版本的事件中
+		enView, err := view.at(en.schemaVersion)
+		if err != nil {
+			trace.fail(err)
+			c.logger.Warnf("Enricher %s skipped: %v", en.name, err)
+			continue
+		}
+		if trace != nil {
+			trace.SchemaVersion = en.schemaVersion
+		}
+
+		if !en.prefilter.match(enView) {
+			en.counters.skipped.Add(1)
+			trace.skip()
+			continue
+		}
+		en.counters.invocations.Add(1)
+
+		eventData, err := enView.payload(en.projection)
+		if err != nil {
+			return err
+		}
+
+		fields, err := en.run(eventData, event.ID, trace)
+		if err != nil {
+			trace.fail(err)
+			c.logger.Warnf("Enricher %s failed: %v", en.name, err)
+			continue
+		}
+		if fields == nil {
+			continue
+		}
+
+		if event.Data == nil {
+			event.Data = make(map[string]interface{})
+		}
+		enrichments, ok := event.Data[enrichmentsKey].(map[string]interface{})
+		if !ok {
+			enrichments = make(map[string]interface{})
+			event.Data[enrichmentsKey] = enrichments
+		}
+		enrichments[en.name] = fields
+		view.reset()
+	}
+
+	return nil
+}
+
+// stats 返回富化规则的调用统计
+func (c *enricherChain) stats() []RuleStats {
+	var stats []RuleStats
+	for _, en := range c.enrichers {
+		stats = append(stats, en.counters.snapshot(en.name, KindEnricher))
+	}
+	return stats
+}
+
+// close 关闭所有富化规则
+func (c *enricherChain) close() {
+	for _, en := range c.enrichers {
+		if err := en.close(); err != nil {
+			c.logger.Warnf("Enricher %s shutdown failed: %v", en.name, err)
+		}
+	}
+	c.enrichers = nil
+}
@@ -0,0 +1,196 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wasm-threat-detector/host/internal/events"
+)
+
+// eventView 缓存一个事件的序列化结果和字段值，在同一事件的多个规则之间共享
+//
+// 字段路径以事件 JSON 为根，用 "." 分隔，例如 "type"、"data.process.name"。
+type eventView struct {
+	event     *events.Event
+	data      []byte
+	values    map[string]interface{} // Data 中按键展开为通用 JSON 表示的值
+	projected map[string][]byte      // 按投影缓存的负载
+	versions  map[int]*eventView     // 转换为其他结构版本的视图
+}
+
+// newEventView 为事件创建视图，序列化都在首次使用时进行
+func newEventView(event *events.Event) *eventView {
+	return &eventView{event: event}
+}
+
+// json 返回事件完整的 JSON 序列化结果
+func (v *eventView) json() ([]byte, error) {
+	if v.data == nil {
+		data, err := v.event.ToJSON()
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize event: %w", err)
+		}
+		v.data = data
+	}
+	return v.data, nil
+}
+
+// at 返回指定结构版本的事件视图，版本与事件相同时返回自身
+func (v *eventView) at(version int) (*eventView, error) {
+	if version == v.event.SchemaVersion {
+		return v, nil
+	}
+
+	if view, ok := v.versions[version]; ok {
+		return view, nil
+	}
+
+	event, err := translateEvent(v.event, version)
+	if err != nil {
+		return nil, err
+	}
+
+	if v.versions == nil {
+		v.versions = make(map[int]*eventView)
+	}
+	view := newEventView(event)
+	v.versions[version] = view
+
+	return view, nil
+}
+
+// payload 返回发送给规则的负载，projection 为 nil 时返回完整事件
+func (v *eventView) payload(p *projection) ([]byte, error) {
+	if p == nil {
+		return v.json()
+	}
+
+	if data, ok := v.projected[p.key]; ok {
+		return data, nil
+	}
+
+	// 投影后的负载也带有结构版本，规则可以据此确认字段结构
+	doc := map[string]interface{}{"schema_version": v.event.SchemaVersion}
+	for _, path := range p.paths {
+		if value, ok := v.lookup(path); ok {
+			setPath(doc, strings.Split(path, "."), value)
+		}
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize projected event: %w", err)
+	}
+
+	if v.projected == nil {
+		v.projected = make(map[string][]byte)
+	}
+	v.projected[p.key] = data
+
+	return data, nil
+}
+
+// lookup 按字段路径查找值，只展开路径经过的 Data 项
+func (v *eventView) lookup(path string) (interface{}, bool) {
+	keys := strings.Split(path, ".")
+	event := v.event
+
+	switch keys[0] {
+	case "schema_version":
+		return event.SchemaVersion, len(keys) == 1
+	case "id":
+		return event.ID, len(keys) == 1
+	case "type":
+		return string(event.Type), len(keys) == 1
+	case "source":
+		return event.Source, len(keys) == 1
+	case "timestamp":
+		return event.Timestamp.Format(time.RFC3339Nano), len(keys) == 1
+	case "data":
+		if len(keys) == 1 {
+			data := make(map[string]interface{}, len(event.Data))
+			for key := range event.Data {
+				data[key], _ = v.dataValue(key)
+			}
+			return data, true
+		}
+		value, ok := v.dataValue(keys[1])
+		if !ok {
+			return nil, false
+		}
+		return lookupPath(value, keys[2:])
+	}
+
+	return nil, false
+}
+
+// dataValue 返回 Data 中某一项的通用 JSON 表示（结构体展开为 map）
+func (v *eventView) dataValue(key string) (interface{}, bool) {
+	if value, ok := v.values[key]; ok {
+		return value, true
+	}
+
+	raw, ok := v.event.Data[key]
+	if !ok {
+		return nil, false
+	}
+
+	value := raw
+	switch raw.(type) {
+	case nil, string, bool, float64, int, int32, int64:
+	default:
+		data, err := json.Marshal(raw)
+		if err != nil {
+			return nil, false
+		}
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil, false
+		}
+	}
+
+	if v.values == nil {
+		v.values = make(map[string]interface{})
+	}
+	v.values[key] = value
+
+	return value, true
+}
+
+// reset 在事件被修改（例如富化）后丢弃缓存
+func (v *eventView) reset() {
+	v.data = nil
+	v.values = nil
+	v.projected = nil
+	v.versions = nil
+}
+
+// lookupPath 在嵌套 map 中按路径查找值
+func lookupPath(value interface{}, path []string) (interface{}, bool) {
+	current := value
+	for _, key := range path {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// setPath 在嵌套 map 中按路径设置值，按需创建中间层
+func setPath(doc map[string]interface{}, path []string, value interface{}) {
+	current := doc
+	for _, key := range path[:len(path)-1] {
+		next, ok := current[key].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			current[key] = next
+		}
+		current = next
+	}
+	current[path[len(path)-1]] = value
+}
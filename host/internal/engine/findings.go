@@ -0,0 +1,36 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// maxFindingsSize 规则返回的检测结果列表 JSON 的最大长度
+const maxFindingsSize = 1 << 20
+
+// finding 规则对单个事件给出的一条检测结果
+//
+// ABI 版本 1 的规则只返回威胁级别，对应一条没有子规则 ID 的结果；
+// ABI 版本 2 的规则返回 JSON 数组，每个元素对应一条结果。
+type finding struct {
+	ID          string `json:"id"`           // 子规则 ID
+	ThreatLevel int32  `json:"threat_level"` // 威胁级别，<= 0 表示无威胁
+	Severity    string `json:"severity"`     // 可选，覆盖按威胁级别映射的严重程度
+	Description string `json:"description"`  // 可选描述
+}
+
+// decodeFindings 解析规则写入内存的检测结果列表
+func decodeFindings(rule string, data []byte) ([]finding, error) {
+	var findings []finding
+	if err := json.Unmarshal(data, &findings); err != nil {
+		return nil, fmt.Errorf("rule %s returned invalid findings: %w", rule, err)
+	}
+
+	for i, f := range findings {
+		if f.Severity != "" && severityRank(f.Severity) < 0 {
+			return nil, fmt.Errorf("rule %s finding %d has unknown severity %q", rule, i, f.Severity)
+		}
+	}
+
+	return findings, nil
+}
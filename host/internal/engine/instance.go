@@ -0,0 +1,253 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bytecodealliance/wasmtime-go/v17"
+	"github.com/wasm-threat-detector/host/internal/events"
+)
+
+// ruleInstance 规则模块的一个实例及其导出函数
+type ruleInstance struct {
+	rule       string
+	abiVersion int32
+	store      *wasmtime.Store
+	instance   *wasmtime.Instance
+	memory     *wasmtime.Memory
+	detect     *wasmtime.Func
+	resultPtr  *wasmtime.Func // ABI 版本 2 的检测结果地址
+	payload    *payloadBuffer
+	counters   *ruleCounters
+
+	// 可选的生命周期钩子，未导出时为 nil
+	init     *wasmtime.Func
+	tick     *wasmtime.Func
+	shutdown *wasmtime.Func
+}
+
+// newRuleStore 创建规则使用的 Store，并按配置限制线性内存大小
+func newRuleStore(engine *wasmtime.Engine, config Config) *wasmtime.Store {
+	store := wasmtime.NewStore(engine)
+	store.Limiter(config.maxMemoryBytes(), -1, -1, -1, -1)
+
+	// 追踪模式下引擎开启了燃料计量，Store 需要燃料才能执行；只有未开启计量时才会失败
+	if config.Trace.Enabled {
+		_ = store.SetFuel(traceFuel)
+	}
+
+	return store
+}
+
+// initializeReactor 调用 WASI reactor 模块导出的 _initialize（Rust cdylib、TinyGo c-shared 等），
+// 在调用其他导出函数之前完成运行时初始化
+func initializeReactor(store *wasmtime.Store, instance *wasmtime.Instance) error {
+	fn := instance.GetFunc(store, "_initialize")
+	if fn == nil {
+		return nil
+	}
+
+	if _, err := fn.Call(store); err != nil {
+		return fmt.Errorf("failed to call _initialize: %w", err)
+	}
+
+	return nil
+}
+
+// newRuleInstance 从已实例化的模块中获取规则导出
+func newRuleInstance(rule string, abiVersion int32, store *wasmtime.Store, instance *wasmtime.Instance, counters *ruleCounters) (*ruleInstance, error) {
+	// 获取检测函数
+	detect := instance.GetFunc(store, "detect")
+	if detect == nil {
+		return nil, fmt.Errorf("wasm module %s does not export 'detect' function", rule)
+	}
+
+	// 获取内存
+	memoryExport := instance.GetExport(store, "memory")
+	if memoryExport == nil {
+		return nil, fmt.Errorf("rule %s has no memory export", rule)
+	}
+	memory := memoryExport.Memory()
+	if memory == nil {
+		return nil, fmt.Errorf("rule %s memory export is not a memory", rule)
+	}
+
+	// ABI 版本 2 通过 result_ptr 返回检测结果列表的地址
+	resultPtr := instance.GetFunc(store, "result_ptr")
+	if abiVersion >= ABIVersion2 && resultPtr == nil {
+		return nil, fmt.Errorf("rule %s uses ABI version %d but does not export 'result_ptr' function", rule, abiVersion)
+	}
+
+	return &ruleInstance{
+		rule:       rule,
+		abiVersion: abiVersion,
+		store:      store,
+		instance:   instance,
+		memory:     memory,
+		detect:     detect,
+		resultPtr:  resultPtr,
+		payload:    newPayloadBuffer(store, instance, memory, counters),
+		counters:   counters,
+		init:       instance.GetFunc(store, "init"),
+		tick:       instance.GetFunc(store, "tick"),
+		shutdown:   instance.GetFunc(store, "shutdown"),
+	}, nil
+}
+
+// hasLifecycle 判断规则是否导出了生命周期钩子，导出钩子的规则需要保持实例
+func (ri *ruleInstance) hasLifecycle() bool {
+	return ri.init != nil || ri.tick != nil || ri.shutdown != nil
+}
+
+// runDetect 将事件数据写入 Wasm 内存并调用检测函数，返回检测结果
+//
+// trace 不为 nil 时记录实际写入的负载、燃料消耗、返回值和规则写入的检测结果。
+func (ri *ruleInstance) runDetect(eventData []byte, trace *RuleTrace) ([]finding, error) {
+	// 写入事件数据到 Wasm 内存，必要时扩展内存或截断负载
+	payloadPtr, payload, err := ri.payload.write(eventData)
+	if err != nil {
+		return nil, fmt.Errorf("rule %s: %w", ri.rule, err)
+	}
+	if trace != nil {
+		trace.Payload = payload
+		trace.Truncated = len(payload) != len(eventData)
+	}
+
+	// 调用检测函数
+	fuel := startFuel(ri.store, trace)
+	result, err := ri.detect.Call(ri.store, payloadPtr, int32(len(payload)))
+	fuel.stop(trace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call detect function in rule %s: %w", ri.rule, err)
+	}
+
+	return ri.findings(result, trace)
+}
+
+// findings 按 ABI 版本解释 detect 或 tick 的返回值
+func (ri *ruleInstance) findings(result interface{}, trace *RuleTrace) ([]finding, error) {
+	value, err := resultLevel(ri.rule, result)
+	if err != nil {
+		return nil, err
+	}
+	if trace != nil {
+		trace.ReturnValue = value
+	}
+
+	// 版本 1：返回值即威胁级别
+	if ri.abiVersion < ABIVersion2 {
+		return []finding{{ThreatLevel: value}}, nil
+	}
+
+	// 版本 2：返回值是检测结果列表 JSON 的长度
+	switch {
+	case value == 0:
+		return nil, nil
+	case value < 0 || value > maxFindingsSize:
+		return nil, fmt.Errorf("rule %s returned invalid findings length %d", ri.rule, value)
+	}
+
+	ptrResult, err := ri.resultPtr.Call(ri.store)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call result_ptr function in rule %s: %w", ri.rule, err)
+	}
+	ptr, err := resultLevel(ri.rule, ptrResult)
+	if err != nil {
+		return nil, err
+	}
+
+	memoryData := ri.memory.UnsafeData(ri.store)
+	if ptr < 0 || int(ptr)+int(value) > len(memoryData) {
+		return nil, fmt.Errorf("rule %s findings at %d+%d are out of memory bounds", ri.rule, ptr, value)
+	}
+
+	data := memoryData[ptr : ptr+value]
+	if trace != nil {
+		trace.Result = append(json.RawMessage(nil), data...)
+	}
+
+	return decodeFindings(ri.rule, data)
+}
+
+// runInit 调用 init 钩子，返回非 0 表示初始化失败
+func (ri *ruleInstance) runInit() error {
+	if ri.init == nil {
+		return nil
+	}
+
+	result, err := ri.init.Call(ri.store)
+	if err != nil {
+		return fmt.Errorf("failed to call init function in rule %s: %w", ri.rule, err)
+	}
+
+	code, err := resultLevel(ri.rule, result)
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		return fmt.Errorf("init function in rule %s returned %d", ri.rule, code)
+	}
+
+	return nil
+}
+
+// runTick 调用 tick 钩子，参数为 Unix 毫秒时间戳，返回值与 detect 相同
+func (ri *ruleInstance) runTick(now time.Time) ([]finding, error) {
+	if ri.tick == nil {
+		return nil, nil
+	}
+
+	result, err := ri.tick.Call(ri.store, now.UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("failed to call tick function in rule %s: %w", ri.rule, err)
+	}
+
+	return ri.findings(result, nil)
+}
+
+// runShutdown 调用 shutdown 钩子
+func (ri *ruleInstance) runShutdown() error {
+	if ri.shutdown == nil {
+		return nil
+	}
+
+	if _, err := ri.shutdown.Call(ri.store); err != nil {
+		return fmt.Errorf("failed to call shutdown function in rule %s: %w", ri.rule, err)
+	}
+
+	return nil
+}
+
+// resultLevel 将函数返回值转换为 int32
+func resultLevel(rule string, result interface{}) (int32, error) {
+	// 检查返回值 - Call 返回单个值
+	if result == nil {
+		return 0, fmt.Errorf("rule %s returned no result", rule)
+	}
+
+	// 获取威胁级别 - 直接从 Val 类型获取
+	switch v := result.(type) {
+	case int32:
+		return v, nil
+	case *wasmtime.Val:
+		return v.I32(), nil
+	default:
+		return 0, fmt.Errorf("rule %s returned unexpected result type", rule)
+	}
+}
+
+// newTickEvent 为 tick 钩子产生的检测结果创建定时事件
+func newTickEvent(rule string, now time.Time) *events.Event {
+	return &events.Event{
+		SchemaVersion: events.CurrentSchemaVersion,
+		ID:            fmt.Sprintf("tick_%s_%d", rule, now.Unix()),
+		Type:          events.EventTypeTimer,
+		Timestamp:     now,
+		Source:        "engine",
+		Data: map[string]interface{}{
+			"action": "tick",
+			"rule":   rule,
+		},
+	}
+}
@@ -2,6 +2,7 @@ package engine
 
 import (
 	"context"
+	"time"
 
 	"github.com/wasm-threat-detector/host/internal/events"
 )
@@ -12,6 +13,8 @@ type ThreatEngine interface {
 	LoadRulesFromDir(rulesDir string) error
 	UnloadRule(name string) error
 	DetectThreat(ctx context.Context, event *events.Event) ([]*events.DetectionResult, error)
+	Tick(ctx context.Context, now time.Time) ([]*events.DetectionResult, error)
 	GetLoadedRules() []string
+	Stats() []RuleStats
 	Close() error
 }
@@ -0,0 +1,144 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// manifestFileName 规则目录内的通用清单文件名
+const manifestFileName = "manifest.yaml"
+
+// 规则类型
+const (
+	KindDetector = "detector" // 检测规则，产生检测结果
+	KindEnricher = "enricher" // 富化规则，在检测规则之前为事件补充字段
+)
+
+// RuleManifest 规则清单，描述规则的元数据和所需能力
+type RuleManifest struct {
+	Name           string       `yaml:"name"`
+	Version        string       `yaml:"version"`
+	Description    string       `yaml:"description"`
+	Kind           string       `yaml:"kind"`  // detector（默认）或 enricher
+	Order          int          `yaml:"order"` // 富化规则的执行顺序，从小到大，相同时按名称
+	Prefilter      Prefilter    `yaml:"prefilter"`
+	Fields         []string     `yaml:"fields"`          // 规则使用的字段路径，声明后只发送这些字段
+	SchemaVersions []int        `yaml:"schema_versions"` // 规则支持的事件结构版本，未声明时视为 [1]
+	Capabilities   Capabilities `yaml:"capabilities"`
+
+	// dir 清单所在目录，用于解析相对路径
+	dir string
+}
+
+// Capabilities 规则声明的 WASI 能力，引擎只授予声明的能力
+type Capabilities struct {
+	Dirs  []DirCapability `yaml:"dirs"`  // 预打开目录，WASI 运行时无法只读授予，声明后加载失败
+	Env   []string        `yaml:"env"`   // 环境变量，"NAME" 继承宿主值，"NAME=value" 使用固定值
+	Clock bool            `yaml:"clock"` // 时钟访问
+}
+
+// DirCapability 预打开目录
+type DirCapability struct {
+	Host  string `yaml:"host"`  // 宿主路径，相对路径基于清单所在目录
+	Guest string `yaml:"guest"` // 规则内可见的路径
+}
+
+// ManifestPath 返回 Wasm 文件对应的清单路径，不存在时返回空字符串
+//
+// 优先查找 <name>.manifest.yaml，其次查找同目录下的 manifest.yaml。
+func ManifestPath(wasmPath string) string {
+	candidates := []string{
+		strings.TrimSuffix(wasmPath, ".wasm") + ".manifest.yaml",
+		filepath.Join(filepath.Dir(wasmPath), manifestFileName),
+	}
+
+	for _, path := range candidates {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+	}
+
+	return ""
+}
+
+// LoadManifest 加载 Wasm 文件对应的清单，没有清单时返回空清单
+func LoadManifest(wasmPath string) (*RuleManifest, error) {
+	path := ManifestPath(wasmPath)
+	if path == "" {
+		return &RuleManifest{dir: filepath.Dir(wasmPath)}, nil
+	}
+
+	return ReadManifest(path)
+}
+
+// ReadManifest 读取并校验清单文件
+func ReadManifest(path string) (*RuleManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest %s: %w", path, err)
+	}
+
+	manifest := &RuleManifest{}
+	if err := yaml.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", path, err)
+	}
+	manifest.dir = filepath.Dir(path)
+
+	if err := manifest.validate(); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", path, err)
+	}
+
+	return manifest, nil
+}
+
+// RuleKind 返回规则类型，未声明时为检测规则
+func (m *RuleManifest) RuleKind() string {
+	if m.Kind == "" {
+		return KindDetector
+	}
+	return m.Kind
+}
+
+// validate 校验清单内容
+func (m *RuleManifest) validate() error {
+	if kind := m.RuleKind(); kind != KindDetector && kind != KindEnricher {
+		return fmt.Errorf("unknown kind %q (expected %s or %s)", m.Kind, KindDetector, KindEnricher)
+	}
+
+	if err := m.Prefilter.validate(); err != nil {
+		return err
+	}
+
+	if err := validateFields(m.Fields); err != nil {
+		return err
+	}
+
+	for i, version := range m.SchemaVersions {
+		if version < 1 {
+			return fmt.Errorf("schema_versions[%d]: invalid version %d", i, version)
+		}
+	}
+
+	for i, env := range m.Capabilities.Env {
+		name, _, _ := strings.Cut(env, "=")
+		if name == "" {
+			return fmt.Errorf("capabilities.env[%d]: variable name is required", i)
+		}
+	}
+
+	return nil
+}
+
+// ruleName 返回规则名称：优先使用清单中的名称，否则使用去掉 .wasm 扩展名的文件名
+func ruleName(wasmPath string) string {
+	if path := ManifestPath(wasmPath); path != "" {
+		if manifest, err := ReadManifest(path); err == nil && manifest.Name != "" {
+			return manifest.Name
+		}
+	}
+	return strings.TrimSuffix(filepath.Base(wasmPath), ".wasm")
+}
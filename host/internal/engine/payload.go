@@ -0,0 +1,206 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/bytecodealliance/wasmtime-go/v17"
+)
+
+// eventDataOffset 规则未导出 alloc 时事件数据写入 Wasm 内存的固定偏移
+const eventDataOffset = 1024
+
+// wasmPageSize Wasm 内存页大小
+const wasmPageSize = 64 * 1024
+
+// maxTruncateRounds 截断负载时最多缩短字符串的次数
+const maxTruncateRounds = 64
+
+// payloadBuffer 把负载写入规则实例的线性内存，每个实例一个
+//
+// 规则导出 alloc(len) -> ptr 时负载写入规则分配的缓冲区。未导出时，放得进模块初始内存的负载
+// 写入固定偏移 eventDataOffset；更大的负载写入宿主在内存末尾扩展出的区域，而不是从固定偏移
+// 一直覆盖到规则的静态数据和堆。规则的分配器按 memory.grow 的返回值使用新页，不会分配到这个区域，
+// 同一实例之后的大负载复用该区域。
+type payloadBuffer struct {
+	store    *wasmtime.Store
+	memory   *wasmtime.Memory
+	alloc    *wasmtime.Func // 规则导出的 alloc，未导出时为 nil
+	counters *ruleCounters
+
+	fixedSize  int // 固定偏移处可以写入的字节数
+	region     int // 宿主扩展出的区域的起始偏移，0 表示还没有扩展
+	regionSize int
+}
+
+// newPayloadBuffer 创建实例的负载缓冲区
+func newPayloadBuffer(store *wasmtime.Store, instance *wasmtime.Instance, memory *wasmtime.Memory, counters *ruleCounters) *payloadBuffer {
+	return &payloadBuffer{
+		store:     store,
+		memory:    memory,
+		alloc:     instance.GetFunc(store, "alloc"),
+		counters:  counters,
+		fixedSize: int(memory.Type(store).Minimum())*wasmPageSize - eventDataOffset,
+	}
+}
+
+// write 写入负载，返回负载的地址和实际写入的负载
+//
+// 内存不足时先按需扩展内存（受 Store 的内存限制和模块声明的最大页数约束）；
+// 无法扩展时截断负载，截断后的负载仍是合法 JSON，并带有 truncated 和 original_size 字段。
+func (b *payloadBuffer) write(payload []byte) (int32, []byte, error) {
+	if b.alloc != nil {
+		return b.writeAllocated(payload)
+	}
+	if len(payload) <= b.fixedSize {
+		copy(b.memory.UnsafeData(b.store)[eventDataOffset:], payload)
+		return eventDataOffset, payload, nil
+	}
+	return b.writeRegion(payload)
+}
+
+// writeAllocated 写入规则 alloc 返回的缓冲区，alloc 返回 0 时把负载减半后重试
+func (b *payloadBuffer) writeAllocated(payload []byte) (int32, []byte, error) {
+	original := payload
+	for {
+		result, err := b.alloc.Call(b.store, int32(len(payload)))
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to call alloc function: %w", err)
+		}
+		ptr, ok := result.(int32)
+		if !ok {
+			return 0, nil, fmt.Errorf("alloc function returned unexpected result type")
+		}
+
+		if ptr != 0 {
+			data := b.memory.UnsafeData(b.store)
+			if ptr < 0 || int(ptr)+len(payload) > len(data) {
+				return 0, nil, fmt.Errorf("alloc function returned buffer at %d+%d that is out of memory bounds", ptr, len(payload))
+			}
+			if len(payload) != len(original) {
+				b.counters.truncated.Add(1)
+			}
+			copy(data[ptr:], payload)
+			return ptr, payload, nil
+		}
+
+		truncated, err := truncatePayload(original, len(payload)/2)
+		if err != nil {
+			return 0, nil, err
+		}
+		payload = truncated
+	}
+}
+
+// writeRegion 写入宿主扩展出的区域，区域不够大时扩展内存
+func (b *payloadBuffer) writeRegion(payload []byte) (int32, []byte, error) {
+	size := int(b.memory.DataSize(b.store))
+
+	// 区域位于内存末尾时原地扩展，否则（规则在之后扩展过内存）在末尾新建区域
+	if b.region == 0 || (len(payload) > b.regionSize && b.region+b.regionSize != size) {
+		b.region, b.regionSize = size, 0
+	}
+
+	if len(payload) > b.regionSize {
+		pages := uint64((len(payload) - b.regionSize + wasmPageSize - 1) / wasmPageSize)
+		if _, err := b.memory.Grow(b.store, pages); err == nil {
+			b.counters.grown.Add(1)
+			b.regionSize += int(pages) * wasmPageSize
+		}
+	}
+
+	if len(payload) > b.regionSize {
+		limit := b.regionSize
+		if limit < b.fixedSize {
+			limit = b.fixedSize
+		}
+		truncated, err := truncatePayload(payload, limit)
+		if err != nil {
+			return 0, nil, err
+		}
+		b.counters.truncated.Add(1)
+		if len(truncated) > b.regionSize {
+			copy(b.memory.UnsafeData(b.store)[eventDataOffset:], truncated)
+			return eventDataOffset, truncated, nil
+		}
+		payload = truncated
+	}
+
+	copy(b.memory.UnsafeData(b.store)[b.region:], payload)
+	return int32(b.region), payload, nil
+}
+
+// truncatePayload 缩短负载中最长的字符串直到不超过 limit 字节
+//
+// 顶层对象会加上 "truncated": true 和 "original_size" 字段，规则据此判断负载被截断。
+func truncatePayload(payload []byte, limit int) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to decode payload for truncation: %w", err)
+	}
+	if obj, ok := doc.(map[string]interface{}); ok {
+		obj["truncated"] = true
+		obj["original_size"] = len(payload)
+	}
+
+	for i := 0; i < maxTruncateRounds; i++ {
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize truncated payload: %w", err)
+		}
+		if len(data) <= limit {
+			return data, nil
+		}
+
+		value, set := longestString(doc)
+		if set == nil || value == "" {
+			break
+		}
+
+		// JSON 中的字符串长度不小于原始长度，按超出的字节数缩短即可
+		n := len(value) - (len(data) - limit)
+		if n < 0 {
+			n = 0
+		}
+		for n > 0 && !utf8.RuneStart(value[n]) {
+			n--
+		}
+		set(value[:n])
+	}
+
+	return nil, fmt.Errorf("payload of %d bytes cannot be truncated to %d bytes", len(payload), limit)
+}
+
+// longestString 查找文档中最长的字符串值，返回其值和修改函数
+func longestString(doc interface{}) (string, func(string)) {
+	var longest string
+	var setter func(string)
+
+	var walk func(v interface{}, set func(string))
+	walk = func(v interface{}, set func(string)) {
+		switch value := v.(type) {
+		case string:
+			if len(value) > len(longest) {
+				longest, setter = value, set
+			}
+		case map[string]interface{}:
+			for key, item := range value {
+				m, k := value, key
+				walk(item, func(s string) { m[k] = s })
+			}
+		case []interface{}:
+			for i, item := range value {
+				a, idx := value, i
+				walk(item, func(s string) { a[idx] = s })
+			}
+		}
+	}
+	walk(doc, nil)
+
+	return longest, setter
+}
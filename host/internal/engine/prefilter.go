@@ -0,0 +1,143 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Prefilter 规则清单中声明的预过滤条件，宿主在调用模块之前求值，不满足时跳过规则
+//
+// 所有声明的条件都满足时才调用模块；列表中的值满足任意一个即可。
+// 追踪配置 engine.trace.events 也使用相同的条件选择事件。
+type Prefilter struct {
+	EventTypes   []string         `yaml:"event_types" mapstructure:"event_types"`     // 事件类型，例如 process、network
+	Actions      []string         `yaml:"actions" mapstructure:"actions"`             // data.action 的取值
+	ProcessNames []string         `yaml:"process_names" mapstructure:"process_names"` // 进程名，来自 data.process.name 或 data.<类型>.process_name
+	Fields       []FieldCondition `yaml:"fields" mapstructure:"fields"`               // 字段条件
+}
+
+// FieldCondition 字段条件，声明的操作都需要满足
+type FieldCondition struct {
+	Path     string `yaml:"path" mapstructure:"path"`         // 字段路径，以事件 JSON 为根，例如 data.process.command_line
+	Equals   string `yaml:"equals" mapstructure:"equals"`     // 等于
+	Contains string `yaml:"contains" mapstructure:"contains"` // 包含子串
+	Prefix   string `yaml:"prefix" mapstructure:"prefix"`     // 以指定前缀开头
+}
+
+// processNamePaths 查找进程名的字段路径
+var processNamePaths = []string{
+	"data.process.name",
+	"data.network.process_name",
+	"data.file.process_name",
+}
+
+// validate 校验预过滤条件
+func (p Prefilter) validate() error {
+	for i, field := range p.Fields {
+		if field.Path == "" {
+			return fmt.Errorf("prefilter.fields[%d]: path is required", i)
+		}
+		if field.Equals == "" && field.Contains == "" && field.Prefix == "" {
+			return fmt.Errorf("prefilter.fields[%d]: one of equals, contains or prefix is required", i)
+		}
+	}
+	return nil
+}
+
+// prefilter 编译后的预过滤条件
+type prefilter struct {
+	eventTypes   map[string]bool
+	actions      map[string]bool
+	processNames map[string]bool
+	fields       []FieldCondition
+}
+
+// newPrefilter 编译预过滤条件，没有声明任何条件时返回 nil
+func newPrefilter(p Prefilter) *prefilter {
+	if len(p.EventTypes) == 0 && len(p.Actions) == 0 && len(p.ProcessNames) == 0 && len(p.Fields) == 0 {
+		return nil
+	}
+
+	return &prefilter{
+		eventTypes:   stringSet(p.EventTypes),
+		actions:      stringSet(p.Actions),
+		processNames: stringSet(p.ProcessNames),
+		fields:       p.Fields,
+	}
+}
+
+// match 判断事件是否满足预过滤条件，nil 表示不过滤
+func (p *prefilter) match(view *eventView) bool {
+	if p == nil {
+		return true
+	}
+
+	event := view.event
+
+	if p.eventTypes != nil && !p.eventTypes[string(event.Type)] {
+		return false
+	}
+
+	if p.actions != nil {
+		action, _ := event.Data["action"].(string)
+		if !p.actions[action] {
+			return false
+		}
+	}
+
+	if p.processNames != nil && !p.matchProcessName(view) {
+		return false
+	}
+
+	for _, field := range p.fields {
+		value, ok := view.lookup(field.Path)
+		if !ok || !field.match(value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchProcessName 判断事件的进程名是否在集合中
+func (p *prefilter) matchProcessName(view *eventView) bool {
+	for _, path := range processNamePaths {
+		if value, ok := view.lookup(path); ok {
+			if name, ok := value.(string); ok && p.processNames[name] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// match 判断字段值是否满足条件，非字符串值按其文本形式比较
+func (c FieldCondition) match(value interface{}) bool {
+	text, ok := value.(string)
+	if !ok {
+		text = fmt.Sprint(value)
+	}
+
+	if c.Equals != "" && text != c.Equals {
+		return false
+	}
+	if c.Contains != "" && !strings.Contains(text, c.Contains) {
+		return false
+	}
+	if c.Prefix != "" && !strings.HasPrefix(text, c.Prefix) {
+		return false
+	}
+	return true
+}
+
+// stringSet 将列表转换为集合，空列表返回 nil
+func stringSet(values []string) map[string]bool {
+	if len(values) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
@@ -0,0 +1,72 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// projectionRoots 字段路径可以使用的根字段
+var projectionRoots = map[string]bool{
+	"schema_version": true,
+	"id":             true,
+	"type":           true,
+	"timestamp":      true,
+	"source":         true,
+	"data":           true,
+}
+
+// projection 规则声明使用的字段路径，引擎只把这些字段发送给规则
+type projection struct {
+	key   string   // 缓存键，相同字段集合的规则共享同一份负载
+	paths []string // 排序且去掉被其他路径包含的路径
+}
+
+// validateFields 校验清单中声明的字段路径
+func validateFields(fields []string) error {
+	for i, path := range fields {
+		keys := strings.Split(path, ".")
+		if !projectionRoots[keys[0]] {
+			return fmt.Errorf("fields[%d]: path %q must start with one of schema_version, id, type, timestamp, source, data", i, path)
+		}
+		for _, key := range keys {
+			if key == "" {
+				return fmt.Errorf("fields[%d]: invalid path %q", i, path)
+			}
+		}
+	}
+	return nil
+}
+
+// newProjection 编译字段投影，没有声明字段时返回 nil（发送完整事件）
+func newProjection(fields []string) *projection {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	sorted := append([]string(nil), fields...)
+	sort.Strings(sorted)
+
+	// 去掉重复路径和已被父路径包含的路径，例如有 data.process 时去掉 data.process.name
+	var paths []string
+	for _, path := range sorted {
+		if !coveredBy(path, paths) {
+			paths = append(paths, path)
+		}
+	}
+
+	return &projection{
+		key:   strings.Join(paths, ","),
+		paths: paths,
+	}
+}
+
+// coveredBy 判断路径是否与已有路径相同或位于已有路径之下
+func coveredBy(path string, paths []string) bool {
+	for _, p := range paths {
+		if path == p || strings.HasPrefix(path, p+".") {
+			return true
+		}
+	}
+	return false
+}
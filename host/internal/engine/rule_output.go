@@ -0,0 +1,227 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bytecodealliance/wasmtime-go/v17"
+	"github.com/sirupsen/logrus"
+)
+
+// ruleStreams 规则输出流名称，与 ruleOutput.paths 下标对应
+var ruleStreams = [2]string{"stdout", "stderr"}
+
+// ruleOutputs 管理引擎内所有规则的输出捕获文件
+type ruleOutputs struct {
+	dir    string
+	seq    int // 捕获文件序号，同名规则重新加载时新旧实例不共用文件
+	config RuleOutputConfig
+	logger *logrus.Logger
+}
+
+// newRuleOutputs 创建规则输出管理器
+func newRuleOutputs(logger *logrus.Logger, config RuleOutputConfig) *ruleOutputs {
+	return &ruleOutputs{
+		config: config,
+		logger: logger,
+	}
+}
+
+// open 为规则实例创建输出捕获，捕获文件名带有序号，不再使用时调用 ruleOutput.close 删除
+func (o *ruleOutputs) open(rule string, discard bool) (*ruleOutput, error) {
+	out := &ruleOutput{
+		rule:    rule,
+		discard: discard,
+		limiter: &lineLimiter{max: o.config.MaxLines, interval: o.config.Interval},
+		logger:  o.logger,
+	}
+	if discard {
+		return out, nil
+	}
+
+	// 捕获文件目录在第一次使用时创建
+	if o.dir == "" {
+		dir, err := os.MkdirTemp("", "wasm-rule-output-")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create rule output directory: %w", err)
+		}
+		o.dir = dir
+	}
+
+	o.seq++
+	for i, stream := range ruleStreams {
+		out.paths[i] = filepath.Join(o.dir, fmt.Sprintf("%s.%d.%s", rule, o.seq, stream))
+	}
+
+	return out, nil
+}
+
+// close 删除所有捕获文件
+func (o *ruleOutputs) close() error {
+	if o.dir == "" {
+		return nil
+	}
+	return os.RemoveAll(o.dir)
+}
+
+// ruleOutput 捕获单个规则的 stdout/stderr，并通过日志重新输出
+type ruleOutput struct {
+	rule    string
+	discard bool
+	paths   [2]string
+	offsets [2]int64
+	limiter *lineLimiter
+	logger  *logrus.Logger
+}
+
+// configure 将规则的 stdout/stderr 重定向到捕获文件
+func (o *ruleOutput) configure(wasiConfig *wasmtime.WasiConfig) error {
+	// 不设置 stdout/stderr 时 WASI 会丢弃输出
+	if o.discard {
+		return nil
+	}
+
+	if err := wasiConfig.SetStdoutFile(o.paths[0]); err != nil {
+		return fmt.Errorf("failed to redirect stdout of rule %s: %w", o.rule, err)
+	}
+	if err := wasiConfig.SetStderrFile(o.paths[1]); err != nil {
+		return fmt.Errorf("failed to redirect stderr of rule %s: %w", o.rule, err)
+	}
+
+	// 文件在实例化时被截断
+	o.offsets = [2]int64{}
+
+	return nil
+}
+
+// close 删除规则实例的捕获文件，调用前应先 flush 剩余的输出
+func (o *ruleOutput) close() {
+	if o.discard {
+		return
+	}
+
+	for i, path := range o.paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			o.logger.Debugf("Failed to remove %s of rule %s: %v", ruleStreams[i], o.rule, err)
+		}
+	}
+}
+
+// flush 读取自上次调用以来的新输出，并带上规则名和事件 ID 写入日志
+func (o *ruleOutput) flush(eventID string) {
+	o.flushTrace(eventID, nil)
+}
+
+// flushTrace 与 flush 相同，trace 不为 nil 时同时把每一行记录到追踪记录中（不受限流影响）
+func (o *ruleOutput) flushTrace(eventID string, trace *RuleTrace) {
+	if o.discard {
+		return
+	}
+
+	for i, stream := range ruleStreams {
+		data, err := o.readNew(i)
+		if err != nil {
+			o.logger.Debugf("Failed to read %s of rule %s: %v", stream, o.rule, err)
+			continue
+		}
+
+		for _, line := range bytes.Split(data, []byte("\n")) {
+			line = bytes.TrimRight(line, "\r")
+			if len(line) == 0 {
+				continue
+			}
+			if trace != nil {
+				trace.Output = append(trace.Output, TraceOutput{Stream: stream, Line: string(line)})
+			}
+
+			allowed, suppressed := o.limiter.allow(time.Now())
+			if suppressed > 0 {
+				o.logger.WithField("rule", o.rule).Warnf("Suppressed %d lines of rule output", suppressed)
+			}
+			if !allowed {
+				continue
+			}
+
+			entry := o.logger.WithFields(logrus.Fields{
+				"rule":     o.rule,
+				"event_id": eventID,
+				"stream":   stream,
+			})
+			if stream == "stderr" {
+				entry.Warn(string(line))
+			} else {
+				entry.Info(string(line))
+			}
+		}
+	}
+}
+
+// readNew 读取指定输出流中尚未处理的内容，读取后截断捕获文件
+//
+// 持久实例的捕获文件在整个生命周期内不会重新打开，读取后截断以免文件无限增长。
+// WASI 不以追加方式写入，截断后规则从原来的位置继续写，文件前面是不占磁盘空间的空洞，
+// 因此 offsets 保持不变，从上次读到的位置继续读取。
+func (o *ruleOutput) readNew(i int) ([]byte, error) {
+	file, err := os.OpenFile(o.paths[i], os.O_RDWR, 0)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(o.offsets[i], io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	o.offsets[i] += int64(len(data))
+
+	if len(data) > 0 {
+		if err := file.Truncate(0); err != nil {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+// lineLimiter 固定时间窗口的行数限流器
+type lineLimiter struct {
+	max         int
+	interval    time.Duration
+	windowStart time.Time
+	count       int
+	suppressed  int
+}
+
+// allow 判断当前行是否可以输出，并返回上一个窗口中被丢弃的行数
+func (l *lineLimiter) allow(now time.Time) (bool, int) {
+	if l.max <= 0 {
+		return true, 0
+	}
+
+	suppressed := 0
+	if now.Sub(l.windowStart) >= l.interval {
+		suppressed = l.suppressed
+		l.windowStart = now
+		l.count = 0
+		l.suppressed = 0
+	}
+
+	if l.count >= l.max {
+		l.suppressed++
+		return false, suppressed
+	}
+
+	l.count++
+	return true, suppressed
+}
@@ -0,0 +1,91 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/wasm-threat-detector/host/internal/events"
+)
+
+// legacySchemaVersion 没有在清单中声明 schema_versions 的规则使用的事件结构版本
+const legacySchemaVersion = 1
+
+// schemaTranslator 将事件从某个结构版本转换到前一个版本
+//
+// 转换函数修改的是事件的副本，Data 中的值已展开为通用 JSON 表示（map、slice、string 等）。
+type schemaTranslator func(event *events.Event) error
+
+// schemaTranslators 按源版本索引的转换函数，schemaTranslators[n] 把版本 n 转换为版本 n-1
+//
+// 修改事件结构并增加 events.CurrentSchemaVersion 时在这里注册转换，
+// 缺少转换的版本之前的规则无法加载。
+var schemaTranslators = map[int]schemaTranslator{}
+
+// minSchemaVersion 返回宿主能够转换到的最低事件结构版本
+func minSchemaVersion() int {
+	version := events.CurrentSchemaVersion
+	for version > 1 && schemaTranslators[version] != nil {
+		version--
+	}
+	return version
+}
+
+// EventSchemaVersion 返回发送给规则的事件结构版本
+//
+// 选择规则支持且宿主能够提供的最高版本，宿主无法提供规则支持的任何版本时返回错误。
+func (m *RuleManifest) EventSchemaVersion() (int, error) {
+	versions := []int{legacySchemaVersion}
+	if len(m.SchemaVersions) > 0 {
+		versions = append([]int(nil), m.SchemaVersions...)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+
+	low := minSchemaVersion()
+	for _, version := range versions {
+		if version <= events.CurrentSchemaVersion && version >= low {
+			return version, nil
+		}
+	}
+
+	return 0, fmt.Errorf("rule supports event schema versions %v, host provides versions %d-%d",
+		versions, low, events.CurrentSchemaVersion)
+}
+
+// normalizeSchemaVersion 校验事件的结构版本，未设置时视为当前版本
+func normalizeSchemaVersion(event *events.Event) error {
+	if event.SchemaVersion == 0 {
+		event.SchemaVersion = events.CurrentSchemaVersion
+	}
+	if event.SchemaVersion != events.CurrentSchemaVersion {
+		return fmt.Errorf("event %s has schema version %d, host schema version is %d",
+			event.ID, event.SchemaVersion, events.CurrentSchemaVersion)
+	}
+	return nil
+}
+
+// translateEvent 将事件逐级转换为指定的结构版本，返回新的事件
+func translateEvent(event *events.Event, version int) (*events.Event, error) {
+	data, err := event.ToJSON()
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize event: %w", err)
+	}
+
+	translated := &events.Event{}
+	if err := json.Unmarshal(data, translated); err != nil {
+		return nil, fmt.Errorf("failed to copy event: %w", err)
+	}
+
+	for translated.SchemaVersion > version {
+		translate, ok := schemaTranslators[translated.SchemaVersion]
+		if !ok {
+			return nil, fmt.Errorf("no translation from event schema version %d", translated.SchemaVersion)
+		}
+		if err := translate(translated); err != nil {
+			return nil, fmt.Errorf("failed to translate event from schema version %d: %w", translated.SchemaVersion, err)
+		}
+		translated.SchemaVersion--
+	}
+
+	return translated, nil
+}
@@ -0,0 +1,223 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/wasm-threat-detector/host/internal/events"
+)
+
+// severities 严重程度，从低到高排列
+var severities = []string{"info", "low", "medium", "high", "critical"}
+
+// severityRank 返回严重程度的排序值，未知严重程度返回 -1
+func severityRank(severity string) int {
+	for i, s := range severities {
+		if s == severity {
+			return i
+		}
+	}
+	return -1
+}
+
+// ScoringConfig 威胁级别到严重程度和置信度的映射
+type ScoringConfig struct {
+	Thresholds map[string]int32  `mapstructure:"thresholds"` // 严重程度 -> 最低威胁级别，低于所有阈值时为 info；规则配置按严重程度覆盖全局配置
+	Confidence *ConfidenceConfig `mapstructure:"confidence"` // 规则配置中设置时整体替换全局公式，包括 base 和 scale 都为 0
+}
+
+// ConfidenceConfig 置信度公式：confidence = base + level * scale，限制在 [0, 1]
+type ConfidenceConfig struct {
+	Base  float64 `mapstructure:"base"`
+	Scale float64 `mapstructure:"scale"`
+}
+
+// FilterConfig 检测结果进入输出处理器之前的过滤条件
+type FilterConfig struct {
+	MinThreatLevel int32  `mapstructure:"min_threat_level"` // 最低威胁级别
+	MinSeverity    string `mapstructure:"min_severity"`     // 最低严重程度
+}
+
+// DefaultScoringConfig 返回默认映射：8 critical, 6 high, 4 medium, 2 low，置信度为 level/10
+func DefaultScoringConfig() ScoringConfig {
+	return ScoringConfig{
+		Thresholds: map[string]int32{
+			"critical": 8,
+			"high":     6,
+			"medium":   4,
+			"low":      2,
+		},
+		Confidence: &ConfidenceConfig{Scale: 0.1},
+	}
+}
+
+// severityThreshold 单个严重程度阈值
+type severityThreshold struct {
+	severity string
+	level    int32
+}
+
+// ruleScoring 单个规则生效的映射和过滤条件
+type ruleScoring struct {
+	thresholds     []severityThreshold // 按级别从高到低排列
+	confidence     ConfidenceConfig
+	minThreatLevel int32
+	minSeverity    int
+}
+
+// newRuleScoring 合并全局配置和规则配置，生成规则的映射和过滤条件
+func newRuleScoring(cfg Config, name string) (*ruleScoring, error) {
+	ruleCfg := cfg.ruleConfig(name)
+
+	var ruleThresholds map[string]int32
+	var confidence ConfidenceConfig
+	if cfg.Scoring.Confidence != nil {
+		confidence = *cfg.Scoring.Confidence
+	}
+	if ruleCfg.Scoring != nil {
+		ruleThresholds = ruleCfg.Scoring.Thresholds
+		if ruleCfg.Scoring.Confidence != nil {
+			confidence = *ruleCfg.Scoring.Confidence
+		}
+	}
+
+	rs := &ruleScoring{
+		confidence:     confidence,
+		minThreatLevel: cfg.Filters.MinThreatLevel,
+	}
+
+	// 规则阈值按严重程度覆盖全局阈值。先加入规则阈值再加入全局阈值，各自按严重程度从高到低，
+	// 稳定排序后级别相同时规则阈值在前，其次是较高的严重程度
+	for _, thresholds := range []map[string]int32{ruleThresholds, cfg.Scoring.Thresholds} {
+		for severity := range thresholds {
+			if severityRank(severity) < 0 {
+				return nil, fmt.Errorf("unknown severity %q in thresholds of rule %s", severity, name)
+			}
+		}
+		for i := len(severities) - 1; i >= 0; i-- {
+			severity := severities[i]
+			level, ok := thresholds[severity]
+			if !ok || rs.hasThreshold(severity) {
+				continue
+			}
+			rs.thresholds = append(rs.thresholds, severityThreshold{severity: severity, level: level})
+		}
+	}
+	sort.SliceStable(rs.thresholds, func(i, j int) bool {
+		return rs.thresholds[i].level > rs.thresholds[j].level
+	})
+
+	if ruleCfg.Threshold > 0 {
+		rs.minThreatLevel = ruleCfg.Threshold
+	}
+
+	minSeverity := cfg.Filters.MinSeverity
+	if ruleCfg.MinSeverity != "" {
+		minSeverity = ruleCfg.MinSeverity
+	}
+	if minSeverity != "" {
+		rs.minSeverity = severityRank(minSeverity)
+		if rs.minSeverity < 0 {
+			return nil, fmt.Errorf("unknown min_severity %q for rule %s", minSeverity, name)
+		}
+	}
+
+	return rs, nil
+}
+
+// hasThreshold 判断是否已有该严重程度的阈值
+func (rs *ruleScoring) hasThreshold(severity string) bool {
+	for _, t := range rs.thresholds {
+		if t.severity == severity {
+			return true
+		}
+	}
+	return false
+}
+
+// severity 根据威胁级别返回严重程度
+func (rs *ruleScoring) severity(level int32) string {
+	for _, t := range rs.thresholds {
+		if level >= t.level {
+			return t.severity
+		}
+	}
+	return "info"
+}
+
+// confidenceOf 根据威胁级别计算置信度
+func (rs *ruleScoring) confidenceOf(level int32) float64 {
+	confidence := rs.confidence.Base + float64(level)*rs.confidence.Scale
+	switch {
+	case confidence < 0:
+		return 0
+	case confidence > 1:
+		return 1
+	default:
+		return confidence
+	}
+}
+
+// passes 判断威胁级别和严重程度是否达到输出条件
+func (rs *ruleScoring) passes(level int32, severity string) bool {
+	if level <= 0 || level < rs.minThreatLevel {
+		return false
+	}
+	return severityRank(severity) >= rs.minSeverity
+}
+
+// results 根据规则返回的检测结果生成 DetectionResult，跳过未达到输出条件的结果
+func (rs *ruleScoring) results(rule string, findings []finding, event *events.Event) []*events.DetectionResult {
+	var results []*events.DetectionResult
+	for _, f := range findings {
+		if result := rs.result(rule, f, event); result != nil {
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// trace 按评分配置解释规则返回的检测结果，用于追踪记录
+func (rs *ruleScoring) trace(findings []finding) []TraceFinding {
+	traced := make([]TraceFinding, 0, len(findings))
+	for _, f := range findings {
+		severity := f.Severity
+		if severity == "" {
+			severity = rs.severity(f.ThreatLevel)
+		}
+		traced = append(traced, TraceFinding{
+			SubRuleID:   f.ID,
+			ThreatLevel: f.ThreatLevel,
+			Severity:    severity,
+			Reported:    rs.passes(f.ThreatLevel, severity),
+		})
+	}
+	return traced
+}
+
+// result 根据单条检测结果生成 DetectionResult，未达到输出条件时返回 nil
+func (rs *ruleScoring) result(rule string, f finding, event *events.Event) *events.DetectionResult {
+	severity := f.Severity
+	if severity == "" {
+		severity = rs.severity(f.ThreatLevel)
+	}
+	if !rs.passes(f.ThreatLevel, severity) {
+		return nil
+	}
+
+	description := f.Description
+	if description == "" {
+		description = fmt.Sprintf("Threat detected by rule %s", rule)
+	}
+
+	return &events.DetectionResult{
+		RuleName:    rule,
+		SubRuleID:   f.ID,
+		Severity:    severity,
+		ThreatLevel: f.ThreatLevel,
+		Threat:      true,
+		Confidence:  rs.confidenceOf(f.ThreatLevel),
+		Description: description,
+		Event:       *event,
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/bytecodealliance/wasmtime-go/v17"
 	"github.com/sirupsen/logrus"
@@ -13,28 +15,55 @@ import (
 )
 
 // SimpleWasmRule 简化的 Wasm 规则
+//
+// 规则默认每个事件使用新的实例；导出了生命周期钩子的规则保持一个实例，
+// 以便在 detect 和 tick 之间保存状态。
 type SimpleWasmRule struct {
-	Name   string
-	Module *wasmtime.Module
-	Engine *wasmtime.Engine
-	mu     sync.RWMutex
+	Name          string
+	Module        *wasmtime.Module
+	Engine        *wasmtime.Engine
+	Manifest      *RuleManifest
+	ABIVersion    int32
+	persistent    *ruleInstance
+	prefilter     *prefilter
+	projection    *projection
+	schemaVersion int // 发送给规则的事件结构版本
+	counters      *ruleCounters
+	output        *ruleOutput
+	scoring       *ruleScoring
+	mu            sync.RWMutex
 }
 
 // SimpleEngine 简化的 Wasm 引擎
 type SimpleEngine struct {
-	engine *wasmtime.Engine
-	rules  map[string]*SimpleWasmRule
-	mu     sync.RWMutex
-	logger *logrus.Logger
+	engine    *wasmtime.Engine
+	rules     map[string]*SimpleWasmRule
+	config    Config
+	outputs   *ruleOutputs
+	enrichers *enricherChain
+	tracer    *tracer
+	mu        sync.RWMutex
+	logger    *logrus.Logger
 }
 
-// NewSimpleEngine 创建新的简化 Wasm 引擎
+// NewSimpleEngine 使用默认配置创建新的简化 Wasm 引擎
 func NewSimpleEngine(logger *logrus.Logger) *SimpleEngine {
+	return NewSimpleEngineWithConfig(logger, DefaultConfig())
+}
+
+// NewSimpleEngineWithConfig 使用指定配置创建新的简化 Wasm 引擎
+func NewSimpleEngineWithConfig(logger *logrus.Logger, cfg Config) *SimpleEngine {
 	config := wasmtime.NewConfig()
+	// 追踪模式下开启燃料计量，记录规则调用消耗的燃料
+	config.SetConsumeFuel(cfg.Trace.Enabled)
 	return &SimpleEngine{
-		engine: wasmtime.NewEngineWithConfig(config),
-		rules:  make(map[string]*SimpleWasmRule),
-		logger: logger,
+		engine:    wasmtime.NewEngineWithConfig(config),
+		rules:     make(map[string]*SimpleWasmRule),
+		config:    cfg,
+		outputs:   newRuleOutputs(logger, cfg.RuleOutput),
+		enrichers: newEnricherChain(logger),
+		tracer:    newTracer(cfg.Trace),
+		logger:    logger,
 	}
 }
 
@@ -55,18 +84,120 @@ func (e *SimpleEngine) LoadRule(name, wasmPath string) error {
 		return fmt.Errorf("failed to compile wasm module %s: %w", wasmPath, err)
 	}
 
+	// 加载规则清单
+	manifest, err := LoadManifest(wasmPath)
+	if err != nil {
+		return err
+	}
+
+	// 校验模块导出、导出签名、导入和清单声明的能力
+	info := describeModule(module)
+	if err := info.Validate(manifest.RuleKind()); err != nil {
+		return fmt.Errorf("rule %s: %w", name, err)
+	}
+	if err := info.CheckCapabilities(manifest); err != nil {
+		return fmt.Errorf("rule %s: %w", name, err)
+	}
+	schemaVersion, err := manifest.EventSchemaVersion()
+	if err != nil {
+		return fmt.Errorf("rule %s: %w", name, err)
+	}
+
+	if manifest.RuleKind() == KindEnricher {
+		return e.loadEnricher(name, wasmPath, module, manifest)
+	}
+
+	scoring, err := newRuleScoring(e.config, name)
+	if err != nil {
+		return err
+	}
+
+	output, err := e.outputs.open(name, e.config.ruleConfig(name).DiscardOutput)
+	if err != nil {
+		return err
+	}
+	// 加载失败时删除本次创建的捕获文件
+	loaded := false
+	defer func() {
+		if !loaded {
+			output.close()
+		}
+	}()
+
 	rule := &SimpleWasmRule{
-		Name:   name,
-		Module: module,
-		Engine: e.engine,
+		Name:          name,
+		Module:        module,
+		Engine:        e.engine,
+		Manifest:      manifest,
+		prefilter:     newPrefilter(manifest.Prefilter),
+		projection:    newProjection(manifest.Fields),
+		schemaVersion: schemaVersion,
+		counters:      &ruleCounters{},
+		output:        output,
+		scoring:       scoring,
+	}
+
+	// 实例化一次以确认模块可以运行，并读取 ABI 版本
+	store, instance, err := e.instantiate(rule)
+	if err != nil {
+		return err
+	}
+	if rule.ABIVersion, err = readABIVersion(store, instance); err != nil {
+		return fmt.Errorf("rule %s: %w", name, err)
+	}
+
+	inst, err := newRuleInstance(name, rule.ABIVersion, store, instance, rule.counters)
+	if err != nil {
+		return err
+	}
+
+	// 导出生命周期钩子的规则保持实例，并调用 init 钩子
+	if inst.hasLifecycle() {
+		err = inst.runInit()
+		output.flush("")
+		if err != nil {
+			return err
+		}
+		rule.persistent = inst
+	}
+
+	// 替换同名规则前先关闭旧规则
+	if old, exists := e.rules[name]; exists {
+		e.shutdownRule(old)
 	}
+	e.enrichers.remove(name)
 
 	e.rules[name] = rule
+	loaded = true
 	e.logger.Infof("Loaded Wasm rule: %s from %s", name, wasmPath)
 
 	return nil
 }
 
+// loadEnricher 加载富化规则，替换同名的规则
+func (e *SimpleEngine) loadEnricher(name, wasmPath string, module *wasmtime.Module, manifest *RuleManifest) error {
+	output, err := e.outputs.open(name, e.config.ruleConfig(name).DiscardOutput)
+	if err != nil {
+		return err
+	}
+
+	en, err := newEnricher(e.engine, e.config, name, module, manifest, output)
+	if err != nil {
+		output.close()
+		return err
+	}
+
+	if old, exists := e.rules[name]; exists {
+		e.shutdownRule(old)
+		delete(e.rules, name)
+	}
+
+	e.enrichers.add(en)
+	e.logger.Infof("Loaded Wasm enricher: %s from %s", name, wasmPath)
+
+	return nil
+}
+
 // LoadRulesFromDir 从目录加载所有 Wasm 规则
 func (e *SimpleEngine) LoadRulesFromDir(rulesDir string) error {
 	return filepath.Walk(rulesDir, func(path string, info os.FileInfo, err error) error {
@@ -74,10 +205,13 @@ func (e *SimpleEngine) LoadRulesFromDir(rulesDir string) error {
 			return err
 		}
 
+		// 跳过隐藏目录（例如已安装规则的历史版本）
+		if info.IsDir() && path != rulesDir && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+
 		if filepath.Ext(path) == ".wasm" {
-			name := filepath.Base(path)
-			name = name[:len(name)-5] // 移除 .wasm 扩展名
-			return e.LoadRule(name, path)
+			return e.LoadRule(ruleName(path), path)
 		}
 
 		return nil
@@ -89,150 +223,211 @@ func (e *SimpleEngine) UnloadRule(name string) error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	if _, exists := e.rules[name]; !exists {
+	if e.enrichers.remove(name) {
+		e.logger.Infof("Unloaded Wasm enricher: %s", name)
+		return nil
+	}
+
+	rule, exists := e.rules[name]
+	if !exists {
 		return fmt.Errorf("rule %s not found", name)
 	}
 
+	e.shutdownRule(rule)
 	delete(e.rules, name)
 	e.logger.Infof("Unloaded Wasm rule: %s", name)
 
 	return nil
 }
 
-// DetectThreat 使用所有规则检测威胁
+// DetectThreat 使用所有规则检测威胁，满足追踪条件的规则调用写入日志
 func (e *SimpleEngine) DetectThreat(ctx context.Context, event *events.Event) ([]*events.DetectionResult, error) {
+	traces := newTraceRecorder(e.tracer, false)
+	results, err := e.detect(ctx, event, traces)
+	traces.log(e.logger)
+	return results, err
+}
+
+// Explain 用所有规则检测单个事件，并返回每个规则的追踪记录
+func (e *SimpleEngine) Explain(ctx context.Context, event *events.Event) ([]*events.DetectionResult, []*RuleTrace, error) {
+	traces := newTraceRecorder(e.tracer, true)
+	results, err := e.detect(ctx, event, traces)
+	return results, traces.sorted(), err
+}
+
+// detect 依次执行富化规则和检测规则，traces 不为 nil 时记录满足追踪条件的规则调用
+func (e *SimpleEngine) detect(ctx context.Context, event *events.Event, traces *traceRecorder) ([]*events.DetectionResult, error) {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
+	if err := normalizeSchemaVersion(event); err != nil {
+		return nil, err
+	}
+
 	var results []*events.DetectionResult
 
-	// 将事件转换为 JSON
-	eventData, err := event.ToJSON()
-	if err != nil {
-		return nil, fmt.Errorf("failed to serialize event: %w", err)
+	// 先按顺序执行富化规则
+	view := newEventView(event)
+	if err := e.enrichers.run(view, traces); err != nil {
+		return nil, err
 	}
 
-	// 对每个规则执行检测
+	// 对每个规则执行检测，不满足预过滤条件的规则不调用模块
 	for _, rule := range e.rules {
-		result, err := e.runSimpleRule(ctx, rule, eventData, event)
+		trace := traces.start(rule.Name, KindDetector, view)
+
+		// 规则支持的结构版本低于当前版本时发送转换后的事件
+		ruleView, err := view.at(rule.schemaVersion)
 		if err != nil {
-			e.logger.Warnf("Rule %s failed: %v", rule.Name, err)
+			trace.fail(err)
+			e.logger.Warnf("Rule %s skipped: %v", rule.Name, err)
+			continue
+		}
+		if trace != nil {
+			trace.SchemaVersion = rule.schemaVersion
+		}
+
+		if !rule.prefilter.match(ruleView) {
+			rule.counters.skipped.Add(1)
+			trace.skip()
 			continue
 		}
+		rule.counters.invocations.Add(1)
+
+		// 将事件转换为 JSON，声明了字段的规则只接收这些字段
+		eventData, err := ruleView.payload(rule.projection)
+		if err != nil {
+			return nil, err
+		}
 
-		if result != nil {
-			results = append(results, result)
+		ruleResults, err := e.runSimpleRule(ctx, rule, eventData, event, trace)
+		if err != nil {
+			trace.fail(err)
+			e.logger.Warnf("Rule %s failed: %v", rule.Name, err)
+			continue
 		}
+
+		results = append(results, ruleResults...)
 	}
 
 	return results, nil
 }
 
-// runSimpleRule 运行单个规则（简化版本）
-func (e *SimpleEngine) runSimpleRule(ctx context.Context, rule *SimpleWasmRule, eventData []byte, event *events.Event) (*events.DetectionResult, error) {
-	rule.mu.Lock()
-	defer rule.mu.Unlock()
-
+// instantiate 为规则创建新的 Store 并实例化模块
+func (e *SimpleEngine) instantiate(rule *SimpleWasmRule) (*wasmtime.Store, *wasmtime.Instance, error) {
 	// 创建 Store
-	store := wasmtime.NewStore(rule.Engine)
+	store := newRuleStore(rule.Engine, e.config)
 
 	// 创建 linker
 	linker := wasmtime.NewLinker(rule.Engine)
-	err := linker.DefineWasi()
-	if err != nil {
-		return nil, fmt.Errorf("failed to define WASI: %w", err)
+	if err := linker.DefineWasi(); err != nil {
+		return nil, nil, fmt.Errorf("failed to define WASI: %w", err)
 	}
 
-	// 创建 WASI 配置
-	wasiConfig := wasmtime.NewWasiConfig()
-	wasiConfig.InheritStdout()
-	wasiConfig.InheritStderr()
+	// 按清单授予 WASI 能力，规则输出重定向到捕获文件
+	wasiConfig, err := newRuleWasiConfig(rule.Manifest, rule.output)
+	if err != nil {
+		return nil, nil, err
+	}
 	store.SetWasi(wasiConfig)
 
 	// 实例化模块
 	instance, err := linker.Instantiate(store, rule.Module)
 	if err != nil {
-		return nil, fmt.Errorf("failed to instantiate wasm module %s: %w", rule.Name, err)
+		return nil, nil, fmt.Errorf("failed to instantiate wasm module %s: %w", rule.Name, err)
 	}
-
-	// 获取检测函数
-	detectFn := instance.GetFunc(store, "detect")
-	if detectFn == nil {
-		return nil, fmt.Errorf("wasm module %s does not export 'detect' function", rule.Name)
-	}
-
-	// 获取内存
-	memory := instance.GetExport(store, "memory")
-	if memory == nil {
-		return nil, fmt.Errorf("rule %s has no memory export", rule.Name)
+	if err := initializeReactor(store, instance); err != nil {
+		return nil, nil, fmt.Errorf("rule %s: %w", rule.Name, err)
 	}
 
-	memoryObj := memory.Memory()
-	if memoryObj == nil {
-		return nil, fmt.Errorf("rule %s memory export is not a memory", rule.Name)
-	}
+	return store, instance, nil
+}
 
-	// 在 Wasm 内存中分配空间（简化版本）
-	dataPtr := int32(1024) // 固定偏移
-	dataLen := int32(len(eventData))
+// runSimpleRule 运行单个规则（简化版本）
+func (e *SimpleEngine) runSimpleRule(ctx context.Context, rule *SimpleWasmRule, eventData []byte, event *events.Event, trace *RuleTrace) ([]*events.DetectionResult, error) {
+	rule.mu.Lock()
+	defer rule.mu.Unlock()
 
-	// 写入事件数据到 Wasm 内存
-	memoryData := memoryObj.UnsafeData(store)
-	if len(memoryData) < int(dataPtr)+len(eventData) {
-		return nil, fmt.Errorf("insufficient memory in rule %s", rule.Name)
+	// 无状态规则为每个事件创建新的实例
+	inst := rule.persistent
+	if inst == nil {
+		store, instance, err := e.instantiate(rule)
+		if err != nil {
+			return nil, err
+		}
+		if inst, err = newRuleInstance(rule.Name, rule.ABIVersion, store, instance, rule.counters); err != nil {
+			return nil, err
+		}
 	}
 
-	copy(memoryData[dataPtr:], eventData)
-
-	// 调用检测函数
-	result, err := detectFn.Call(store, dataPtr, dataLen)
+	// 写入事件数据并调用检测函数
+	findings, err := inst.runDetect(eventData, trace)
+	rule.output.flushTrace(event.ID, trace)
 	if err != nil {
-		return nil, fmt.Errorf("failed to call detect function in rule %s: %w", rule.Name, err)
+		return nil, err
 	}
-
-	// 检查返回值 - Call 返回单个值
-	if result == nil {
-		return nil, fmt.Errorf("rule %s returned no result", rule.Name)
+	if trace != nil {
+		trace.Findings = rule.scoring.trace(findings)
 	}
 
-	// 获取威胁级别 - 直接从 Val 类型获取
-	threatLevel, ok := result.(int32)
-	if !ok {
-		// 尝试从 Val 获取
-		if val, ok := result.(*wasmtime.Val); ok {
-			threatLevel = val.I32()
-		} else {
-			return nil, fmt.Errorf("rule %s returned unexpected result type", rule.Name)
+	// 映射严重程度和置信度，并应用输出过滤条件
+	return rule.scoring.results(rule.Name, findings, event), nil
+}
+
+// Tick 调用所有规则的 tick 钩子，返回定时产生的检测结果
+func (e *SimpleEngine) Tick(ctx context.Context, now time.Time) ([]*events.DetectionResult, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	var results []*events.DetectionResult
+
+	for _, rule := range e.rules {
+		if rule.persistent == nil || rule.persistent.tick == nil {
+			continue
+		}
+
+		ruleResults, err := e.tickRule(rule, now)
+		if err != nil {
+			e.logger.Warnf("Rule %s tick failed: %v", rule.Name, err)
+			continue
 		}
+
+		results = append(results, ruleResults...)
 	}
 
-	if threatLevel > 0 {
-		return &events.DetectionResult{
-			RuleName:    rule.Name,
-			Severity:    e.getSeverityLevel(threatLevel),
-			Threat:      true,
-			Confidence:  float64(threatLevel) / 10.0,
-			Description: fmt.Sprintf("Threat detected by rule %s", rule.Name),
-			Event:       *event,
-		}, nil
+	return results, nil
+}
+
+// tickRule 调用单个规则的 tick 钩子
+func (e *SimpleEngine) tickRule(rule *SimpleWasmRule, now time.Time) ([]*events.DetectionResult, error) {
+	rule.mu.Lock()
+	defer rule.mu.Unlock()
+
+	event := newTickEvent(rule.Name, now)
+
+	findings, err := rule.persistent.runTick(now)
+	rule.output.flush(event.ID)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil, nil
+	return rule.scoring.results(rule.Name, findings, event), nil
 }
 
-// getSeverityLevel 根据威胁级别返回严重程度
-func (e *SimpleEngine) getSeverityLevel(level int32) string {
-	switch {
-	case level >= 8:
-		return "critical"
-	case level >= 6:
-		return "high"
-	case level >= 4:
-		return "medium"
-	case level >= 2:
-		return "low"
-	default:
-		return "info"
+// shutdownRule 调用有状态规则的 shutdown 钩子，并删除规则的捕获文件
+func (e *SimpleEngine) shutdownRule(rule *SimpleWasmRule) {
+	rule.mu.Lock()
+	defer rule.mu.Unlock()
+	defer rule.output.close()
+
+	if rule.persistent == nil {
+		return
+	}
+
+	err := rule.persistent.runShutdown()
+	rule.output.flush("")
+	if err != nil {
+		e.logger.Warnf("Rule %s shutdown failed: %v", rule.Name, err)
 	}
 }
 
@@ -241,7 +436,7 @@ func (e *SimpleEngine) GetLoadedRules() []string {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
-	var rules []string
+	rules := e.enrichers.names()
 	for name := range e.rules {
 		rules = append(rules, name)
 	}
@@ -249,14 +444,33 @@ func (e *SimpleEngine) GetLoadedRules() []string {
 	return rules
 }
 
+// Stats 返回所有规则的调用统计
+func (e *SimpleEngine) Stats() []RuleStats {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	stats := e.enrichers.stats()
+	for _, rule := range e.rules {
+		stats = append(stats, rule.counters.snapshot(rule.Name, KindDetector))
+	}
+
+	return sortStats(stats)
+}
+
 // Close 关闭引擎并清理资源
 func (e *SimpleEngine) Close() error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	for name := range e.rules {
+	for name, rule := range e.rules {
+		e.shutdownRule(rule)
 		delete(e.rules, name)
 	}
+	e.enrichers.close()
+
+	if err := e.outputs.close(); err != nil {
+		e.logger.Warnf("Failed to remove rule output files: %v", err)
+	}
 
 	e.logger.Info("Simple Wasm engine closed")
 	return nil
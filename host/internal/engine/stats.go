@@ -0,0 +1,44 @@
+package engine
+
+import (
+	"sort"
+	"sync/atomic"
+)
+
+// RuleStats 单个规则的调用统计
+type RuleStats struct {
+	Rule        string
+	Kind        string
+	Invocations uint64 // 调用模块的次数
+	Skipped     uint64 // 被预过滤条件跳过的次数
+	Grown       uint64 // 为容纳事件扩展内存的次数
+	Truncated   uint64 // 内存无法扩展而截断事件的次数
+}
+
+// ruleCounters 规则调用计数器
+type ruleCounters struct {
+	invocations atomic.Uint64
+	skipped     atomic.Uint64
+	grown       atomic.Uint64
+	truncated   atomic.Uint64
+}
+
+// snapshot 返回计数器当前值
+func (c *ruleCounters) snapshot(rule, kind string) RuleStats {
+	return RuleStats{
+		Rule:        rule,
+		Kind:        kind,
+		Invocations: c.invocations.Load(),
+		Skipped:     c.skipped.Load(),
+		Grown:       c.grown.Load(),
+		Truncated:   c.truncated.Load(),
+	}
+}
+
+// sortStats 按规则名称排序统计结果
+func sortStats(stats []RuleStats) []RuleStats {
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Rule < stats[j].Rule
+	})
+	return stats
+}
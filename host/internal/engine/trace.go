@@ -0,0 +1,223 @@
+package engine
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/bytecodealliance/wasmtime-go/v17"
+	"github.com/sirupsen/logrus"
+)
+
+// traceFuel 追踪模式下每个 Store 的初始燃料，只用于统计指令消耗，不限制规则执行
+const traceFuel = math.MaxInt64
+
+// 规则对事件的处理结果
+const (
+	TraceInvoked = "invoked" // 调用了规则模块
+	TraceSkipped = "skipped" // 被预过滤条件跳过
+	TraceFailed  = "failed"  // 调用失败或无法准备负载
+)
+
+// TraceConfig 规则决策追踪配置
+//
+// 启用后满足条件的规则调用会记录发送的负载、规则输出、燃料消耗、返回值和解析后的结果，
+// 并写入日志。启用追踪会为所有规则开启燃料计量，带来少量额外开销。
+type TraceConfig struct {
+	Enabled bool      `mapstructure:"enabled"`
+	Rules   []string  `mapstructure:"rules"`  // 只追踪这些规则，空表示所有规则
+	Events  Prefilter `mapstructure:"events"` // 只追踪满足条件的事件，空表示所有事件
+}
+
+// RuleTrace 单个规则处理单个事件的记录
+type RuleTrace struct {
+	Rule          string          `json:"rule"`
+	Kind          string          `json:"kind"`
+	EventID       string          `json:"event_id"`
+	SchemaVersion int             `json:"schema_version"` // 发送给规则的事件结构版本
+	Decision      string          `json:"decision"`
+	Payload       json.RawMessage `json:"payload,omitempty"`   // 写入规则内存的负载
+	Truncated     bool            `json:"truncated,omitempty"` // 负载是否被截断
+	Output        []TraceOutput   `json:"output,omitempty"`    // 规则写到 stdout/stderr 的内容
+	FuelUsed      uint64          `json:"fuel_used,omitempty"` // detect/enrich 消耗的燃料，未开启燃料计量时为 0
+	ReturnValue   int32           `json:"return_value"`        // detect/enrich 的返回值
+	Result        json.RawMessage `json:"result,omitempty"`    // 规则写入的检测结果列表或富化字段
+	Findings      []TraceFinding  `json:"findings,omitempty"`  // 按评分配置解释后的检测结果
+	Duration      time.Duration   `json:"duration"`
+	Error         string          `json:"error,omitempty"`
+}
+
+// TraceOutput 规则输出的一行
+type TraceOutput struct {
+	Stream string `json:"stream"`
+	Line   string `json:"line"`
+}
+
+// TraceFinding 解释后的单条检测结果
+type TraceFinding struct {
+	SubRuleID   string `json:"sub_rule_id,omitempty"`
+	ThreatLevel int32  `json:"threat_level"`
+	Severity    string `json:"severity"`
+	Reported    bool   `json:"reported"` // 是否通过 filters 和 rule_config 的输出条件
+}
+
+// tracer 编译后的追踪条件
+type tracer struct {
+	rules  map[string]bool
+	events *prefilter
+}
+
+// newTracer 编译追踪条件，未启用时返回 nil
+func newTracer(cfg TraceConfig) *tracer {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &tracer{
+		rules:  stringSet(cfg.Rules),
+		events: newPrefilter(cfg.Events),
+	}
+}
+
+// traceRecorder 收集一次检测中的追踪记录
+type traceRecorder struct {
+	tracer *tracer
+	all    bool // 追踪所有规则和事件（explain）
+	traces []*RuleTrace
+}
+
+// newTraceRecorder 为一次检测创建追踪记录器，不需要追踪时返回 nil
+func newTraceRecorder(t *tracer, all bool) *traceRecorder {
+	if t == nil && !all {
+		return nil
+	}
+	return &traceRecorder{tracer: t, all: all}
+}
+
+// start 开始记录规则对事件的处理，规则或事件不满足追踪条件时返回 nil
+func (r *traceRecorder) start(rule, kind string, view *eventView) *RuleTrace {
+	if r == nil {
+		return nil
+	}
+	if !r.all {
+		if r.tracer.rules != nil && !r.tracer.rules[rule] {
+			return nil
+		}
+		if !r.tracer.events.match(view) {
+			return nil
+		}
+	}
+
+	trace := &RuleTrace{
+		Rule:          rule,
+		Kind:          kind,
+		EventID:       view.event.ID,
+		SchemaVersion: view.event.SchemaVersion,
+		Decision:      TraceInvoked,
+	}
+	r.traces = append(r.traces, trace)
+
+	return trace
+}
+
+// log 将追踪记录写入日志
+func (r *traceRecorder) log(logger *logrus.Logger) {
+	if r == nil {
+		return
+	}
+
+	for _, trace := range r.traces {
+		fields := logrus.Fields{
+			"rule":           trace.Rule,
+			"kind":           trace.Kind,
+			"event_id":       trace.EventID,
+			"schema_version": trace.SchemaVersion,
+			"decision":       trace.Decision,
+		}
+		if trace.Decision != TraceSkipped {
+			fields["payload"] = string(trace.Payload)
+			fields["fuel_used"] = trace.FuelUsed
+			fields["return_value"] = trace.ReturnValue
+			fields["duration"] = trace.Duration.String()
+		}
+		if trace.Truncated {
+			fields["truncated"] = true
+		}
+		if len(trace.Result) > 0 {
+			fields["result"] = string(trace.Result)
+		}
+		if len(trace.Findings) > 0 {
+			fields["findings"] = trace.Findings
+		}
+		if len(trace.Output) > 0 {
+			fields["output"] = trace.Output
+		}
+		if trace.Error != "" {
+			fields["error"] = trace.Error
+		}
+
+		logger.WithFields(fields).Info("Rule trace")
+	}
+}
+
+// sorted 返回按执行顺序排列的追踪记录：富化规则在前并保持执行顺序，检测规则按名称排序
+func (r *traceRecorder) sorted() []*RuleTrace {
+	if r == nil {
+		return nil
+	}
+	sort.SliceStable(r.traces, func(i, j int) bool {
+		a, b := r.traces[i], r.traces[j]
+		if a.Kind != b.Kind {
+			return a.Kind == KindEnricher
+		}
+		return a.Kind == KindDetector && a.Rule < b.Rule
+	})
+	return r.traces
+}
+
+// skip 记录规则被预过滤条件跳过
+func (t *RuleTrace) skip() {
+	if t != nil {
+		t.Decision = TraceSkipped
+	}
+}
+
+// fail 记录失败原因
+func (t *RuleTrace) fail(err error) {
+	if t == nil {
+		return
+	}
+	t.Decision = TraceFailed
+	t.Error = err.Error()
+}
+
+// fuelMeter 统计一次调用的耗时和消耗的燃料
+type fuelMeter struct {
+	store  *wasmtime.Store
+	start  time.Time
+	before uint64
+	ok     bool
+}
+
+// startFuel 记录调用开始时间和剩余燃料，未开启燃料计量时不统计燃料
+func startFuel(store *wasmtime.Store, trace *RuleTrace) fuelMeter {
+	if trace == nil {
+		return fuelMeter{}
+	}
+	before, err := store.GetFuel()
+	return fuelMeter{store: store, start: time.Now(), before: before, ok: err == nil}
+}
+
+// stop 将调用耗时和消耗的燃料写入追踪记录
+func (m fuelMeter) stop(trace *RuleTrace) {
+	if trace == nil {
+		return
+	}
+	trace.Duration = time.Since(m.start)
+	if !m.ok {
+		return
+	}
+	if after, err := m.store.GetFuel(); err == nil && after <= m.before {
+		trace.FuelUsed = m.before - after
+	}
+}
@@ -0,0 +1,263 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/bytecodealliance/wasmtime-go/v17"
+)
+
+// 宿主支持的规则 ABI 版本
+//
+// 规则可以导出 abi_version() -> i32 声明使用的 ABI 版本，未导出时视为版本 1。
+const (
+	ABIVersion1 int32 = 1 // detect(ptr, len) -> i32 威胁级别
+	ABIVersion2 int32 = 2 // detect(ptr, len) -> i32 检测结果列表 JSON 的长度，数据位于 result_ptr()
+
+	CurrentABIVersion = ABIVersion2
+)
+
+// supportedABIVersions 宿主支持的 ABI 版本
+var supportedABIVersions = []int32{ABIVersion1, ABIVersion2}
+
+// ModuleInfo Wasm 模块的导出、导入和内存信息
+type ModuleInfo struct {
+	Exports    []ExternInfo
+	Imports    []ExternInfo
+	Memory     *MemoryInfo
+	ABIVersion int32
+}
+
+// ExternInfo 导出或导入项
+type ExternInfo struct {
+	Module    string // 仅导入项有效
+	Name      string
+	Kind      string // func, memory, global, table
+	Signature string // 函数签名或内存限制
+}
+
+// MemoryInfo 导出内存的页数限制（每页 64KiB）
+type MemoryInfo struct {
+	MinPages uint64
+	MaxPages uint64
+	HasMax   bool
+}
+
+// requiredExports 各类规则必须导出的函数及其签名
+var requiredExports = map[string]map[string]string{
+	KindDetector: {
+		"detect": "(i32, i32) -> (i32)",
+	},
+	KindEnricher: {
+		"enrich":     "(i32, i32) -> (i32)",
+		"result_ptr": "() -> (i32)",
+	},
+}
+
+// optionalExports 规则可以导出的函数及其签名
+var optionalExports = map[string]string{
+	"abi_version": "() -> (i32)",
+	"_initialize": "() -> ()",
+	"result_ptr":  "() -> (i32)",
+	"alloc":       "(i32) -> (i32)",
+	"init":        "() -> (i32)",
+	"tick":        "(i64) -> (i32)",
+	"shutdown":    "() -> ()",
+}
+
+// Inspect 编译 Wasm 文件并返回模块信息，包括 ABI 版本
+func Inspect(wasmPath string) (*ModuleInfo, error) {
+	wasmBytes, err := os.ReadFile(wasmPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read wasm file %s: %w", wasmPath, err)
+	}
+
+	engine := wasmtime.NewEngine()
+	module, err := wasmtime.NewModule(engine, wasmBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile wasm module %s: %w", wasmPath, err)
+	}
+
+	info := describeModule(module)
+
+	// 读取 ABI 版本需要实例化模块
+	store := wasmtime.NewStore(engine)
+	store.SetWasi(wasmtime.NewWasiConfig())
+	linker := wasmtime.NewLinker(engine)
+	if err := linker.DefineWasi(); err != nil {
+		return nil, fmt.Errorf("failed to define WASI: %w", err)
+	}
+	instance, err := linker.Instantiate(store, module)
+	if err != nil {
+		return info, fmt.Errorf("failed to instantiate wasm module %s: %w", wasmPath, err)
+	}
+	if err := initializeReactor(store, instance); err != nil {
+		return info, err
+	}
+	if info.ABIVersion, err = readABIVersion(store, instance); err != nil {
+		return info, err
+	}
+
+	return info, nil
+}
+
+// describeModule 收集模块的导出、导入和内存信息
+func describeModule(module *wasmtime.Module) *ModuleInfo {
+	info := &ModuleInfo{}
+
+	for _, exp := range module.Exports() {
+		ext := describeExtern(exp.Type())
+		ext.Name = exp.Name()
+		info.Exports = append(info.Exports, ext)
+
+		if mem := exp.Type().MemoryType(); mem != nil && exp.Name() == "memory" {
+			hasMax, max := mem.Maximum()
+			info.Memory = &MemoryInfo{MinPages: mem.Minimum(), MaxPages: max, HasMax: hasMax}
+		}
+	}
+
+	for _, imp := range module.Imports() {
+		ext := describeExtern(imp.Type())
+		ext.Module = imp.Module()
+		if imp.Name() != nil {
+			ext.Name = *imp.Name()
+		}
+		info.Imports = append(info.Imports, ext)
+	}
+
+	return info
+}
+
+// describeExtern 描述导出或导入项的类型
+func describeExtern(ty *wasmtime.ExternType) ExternInfo {
+	switch {
+	case ty.FuncType() != nil:
+		return ExternInfo{Kind: "func", Signature: funcSignature(ty.FuncType())}
+	case ty.MemoryType() != nil:
+		mem := ty.MemoryType()
+		limits := fmt.Sprintf("min %d pages", mem.Minimum())
+		if hasMax, max := mem.Maximum(); hasMax {
+			limits += fmt.Sprintf(", max %d pages", max)
+		}
+		return ExternInfo{Kind: "memory", Signature: limits}
+	case ty.GlobalType() != nil:
+		return ExternInfo{Kind: "global", Signature: ty.GlobalType().Content().String()}
+	case ty.TableType() != nil:
+		return ExternInfo{Kind: "table", Signature: ty.TableType().Element().String()}
+	default:
+		return ExternInfo{Kind: "unknown"}
+	}
+}
+
+// funcSignature 格式化函数签名，例如 "(i32, i32) -> (i32)"
+func funcSignature(ty *wasmtime.FuncType) string {
+	return fmt.Sprintf("(%s) -> (%s)", joinValTypes(ty.Params()), joinValTypes(ty.Results()))
+}
+
+// joinValTypes 以逗号连接值类型
+func joinValTypes(types []*wasmtime.ValType) string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = t.String()
+	}
+	return strings.Join(names, ", ")
+}
+
+// export 按名称查找导出项
+func (info *ModuleInfo) export(name string) *ExternInfo {
+	for i := range info.Exports {
+		if info.Exports[i].Name == name {
+			return &info.Exports[i]
+		}
+	}
+	return nil
+}
+
+// Validate 检查模块的导出、导出签名和导入是否符合指定类型规则的 ABI
+func (info *ModuleInfo) Validate(kind string) error {
+	var problems []string
+
+	required, ok := requiredExports[kind]
+	if !ok {
+		return fmt.Errorf("unknown rule kind %q", kind)
+	}
+
+	for _, name := range sortedKeys(required) {
+		signature := required[name]
+		exp := info.export(name)
+		switch {
+		case exp == nil:
+			problems = append(problems, fmt.Sprintf("missing export %q", name))
+		case exp.Kind != "func":
+			problems = append(problems, fmt.Sprintf("export %q is a %s, expected func", name, exp.Kind))
+		case exp.Signature != signature:
+			problems = append(problems, fmt.Sprintf("export %q has signature %s, expected %s", name, exp.Signature, signature))
+		}
+	}
+
+	for _, name := range sortedKeys(optionalExports) {
+		if _, ok := required[name]; ok {
+			continue
+		}
+		signature := optionalExports[name]
+		if exp := info.export(name); exp != nil && (exp.Kind != "func" || exp.Signature != signature) {
+			problems = append(problems, fmt.Sprintf("export %q has signature %s, expected %s", name, exp.Signature, signature))
+		}
+	}
+
+	if exp := info.export("memory"); exp == nil {
+		problems = append(problems, `missing export "memory"`)
+	} else if exp.Kind != "memory" {
+		problems = append(problems, fmt.Sprintf(`export "memory" is a %s, expected memory`, exp.Kind))
+	}
+
+	// 宿主只提供 WASI 导入
+	for _, imp := range info.Imports {
+		if imp.Module != wasiModule {
+			problems = append(problems, fmt.Sprintf("unsupported import %s.%s", imp.Module, imp.Name))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid rule module: %s", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// sortedKeys 返回按名称排序的键，使校验结果的顺序固定
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// readABIVersion 调用 abi_version 导出读取规则的 ABI 版本，并检查宿主是否支持
+func readABIVersion(store wasmtime.Storelike, instance *wasmtime.Instance) (int32, error) {
+	fn := instance.GetFunc(store, "abi_version")
+	if fn == nil {
+		return ABIVersion1, nil
+	}
+
+	result, err := fn.Call(store)
+	if err != nil {
+		return 0, fmt.Errorf("failed to call abi_version: %w", err)
+	}
+	version, ok := result.(int32)
+	if !ok {
+		return 0, fmt.Errorf("abi_version returned unexpected result type")
+	}
+
+	for _, supported := range supportedABIVersions {
+		if version == supported {
+			return version, nil
+		}
+	}
+
+	return version, fmt.Errorf("unsupported ABI version %d (host supports %v)", version, supportedABIVersions)
+}
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/bytecodealliance/wasmtime-go/v17"
 	"github.com/sirupsen/logrus"
@@ -14,32 +16,56 @@ import (
 
 // WasmRule 表示一个 Wasm 检测规则
 type WasmRule struct {
-	Name     string
-	Module   *wasmtime.Module
-	Instance *wasmtime.Instance
-	Store    *wasmtime.Store
-	DetectFn *wasmtime.Func
-	mu       sync.RWMutex
+	Name          string
+	Module        *wasmtime.Module
+	Instance      *wasmtime.Instance
+	Store         *wasmtime.Store
+	DetectFn      *wasmtime.Func
+	Manifest      *RuleManifest
+	ABIVersion    int32
+	inst          *ruleInstance
+	prefilter     *prefilter
+	projection    *projection
+	schemaVersion int // 发送给规则的事件结构版本
+	counters      *ruleCounters
+	output        *ruleOutput
+	scoring       *ruleScoring
+	mu            sync.RWMutex
 }
 
 // Engine Wasm 规则引擎
 type Engine struct {
-	engine *wasmtime.Engine
-	rules  map[string]*WasmRule
-	mu     sync.RWMutex
-	logger *logrus.Logger
+	engine    *wasmtime.Engine
+	rules     map[string]*WasmRule
+	config    Config
+	outputs   *ruleOutputs
+	enrichers *enricherChain
+	tracer    *tracer
+	mu        sync.RWMutex
+	logger    *logrus.Logger
 }
 
-// NewEngine 创建新的 Wasm 引擎
+// NewEngine 使用默认配置创建新的 Wasm 引擎
 func NewEngine(logger *logrus.Logger) *Engine {
+	return NewEngineWithConfig(logger, DefaultConfig())
+}
+
+// NewEngineWithConfig 使用指定配置创建新的 Wasm 引擎
+func NewEngineWithConfig(logger *logrus.Logger, cfg Config) *Engine {
 	config := wasmtime.NewConfig()
+	// 追踪模式下开启燃料计量，记录规则调用消耗的燃料
+	config.SetConsumeFuel(cfg.Trace.Enabled)
 	config.SetWasmMultiMemory(true)
 	config.SetWasmMemory64(false)
 
 	return &Engine{
-		engine: wasmtime.NewEngineWithConfig(config),
-		rules:  make(map[string]*WasmRule),
-		logger: logger,
+		engine:    wasmtime.NewEngineWithConfig(config),
+		rules:     make(map[string]*WasmRule),
+		config:    cfg,
+		outputs:   newRuleOutputs(logger, cfg.RuleOutput),
+		enrichers: newEnricherChain(logger),
+		tracer:    newTracer(cfg.Trace),
+		logger:    logger,
 	}
 }
 
@@ -60,8 +86,36 @@ func (e *Engine) LoadRule(name, wasmPath string) error {
 		return fmt.Errorf("failed to compile wasm module %s: %w", wasmPath, err)
 	}
 
+	// 加载规则清单
+	manifest, err := LoadManifest(wasmPath)
+	if err != nil {
+		return err
+	}
+
+	// 校验模块导出、导出签名、导入和清单声明的能力
+	info := describeModule(module)
+	if err := info.Validate(manifest.RuleKind()); err != nil {
+		return fmt.Errorf("rule %s: %w", name, err)
+	}
+	if err := info.CheckCapabilities(manifest); err != nil {
+		return fmt.Errorf("rule %s: %w", name, err)
+	}
+	schemaVersion, err := manifest.EventSchemaVersion()
+	if err != nil {
+		return fmt.Errorf("rule %s: %w", name, err)
+	}
+
+	if manifest.RuleKind() == KindEnricher {
+		return e.loadEnricher(name, wasmPath, module, manifest)
+	}
+
+	scoring, err := newRuleScoring(e.config, name)
+	if err != nil {
+		return err
+	}
+
 	// 创建 Store
-	store := wasmtime.NewStore(e.engine)
+	store := newRuleStore(e.engine, e.config)
 
 	// 创建 linker
 	linker := wasmtime.NewLinker(e.engine)
@@ -70,10 +124,22 @@ func (e *Engine) LoadRule(name, wasmPath string) error {
 		return fmt.Errorf("failed to define WASI: %w", err)
 	}
 
-	// 创建 WASI 配置
-	wasiConfig := wasmtime.NewWasiConfig()
-	wasiConfig.InheritStdout()
-	wasiConfig.InheritStderr()
+	// 按清单授予 WASI 能力，规则输出重定向到捕获文件
+	output, err := e.outputs.open(name, e.config.ruleConfig(name).DiscardOutput)
+	if err != nil {
+		return err
+	}
+	// 加载失败时删除本次创建的捕获文件
+	loaded := false
+	defer func() {
+		if !loaded {
+			output.close()
+		}
+	}()
+	wasiConfig, err := newRuleWasiConfig(manifest, output)
+	if err != nil {
+		return err
+	}
 
 	// 在 store 中设置 WASI
 	store.SetWasi(wasiConfig)
@@ -82,26 +148,85 @@ func (e *Engine) LoadRule(name, wasmPath string) error {
 	instance, err := linker.Instantiate(store, module)
 	if err != nil {
 		return fmt.Errorf("failed to instantiate wasm module %s: %w", wasmPath, err)
-	} // 获取检测函数
-	detectFn := instance.GetFunc(store, "detect")
-	if detectFn == nil {
-		return fmt.Errorf("wasm module %s does not export 'detect' function", wasmPath)
+	}
+	if err := initializeReactor(store, instance); err != nil {
+		return fmt.Errorf("rule %s: %w", name, err)
+	}
+
+	// 读取 ABI 版本
+	abiVersion, err := readABIVersion(store, instance)
+	if err != nil {
+		return fmt.Errorf("rule %s: %w", name, err)
+	}
+
+	// 获取检测函数和生命周期钩子
+	counters := &ruleCounters{}
+	inst, err := newRuleInstance(name, abiVersion, store, instance, counters)
+	if err != nil {
+		return err
+	}
+
+	// 调用 init 钩子
+	err = inst.runInit()
+	output.flush("")
+	if err != nil {
+		return err
 	}
 
 	rule := &WasmRule{
-		Name:     name,
-		Module:   module,
-		Instance: instance,
-		Store:    store,
-		DetectFn: detectFn,
+		Name:          name,
+		Module:        module,
+		Instance:      instance,
+		Store:         store,
+		DetectFn:      inst.detect,
+		Manifest:      manifest,
+		ABIVersion:    abiVersion,
+		inst:          inst,
+		prefilter:     newPrefilter(manifest.Prefilter),
+		projection:    newProjection(manifest.Fields),
+		schemaVersion: schemaVersion,
+		counters:      counters,
+		output:        output,
+		scoring:       scoring,
+	}
+
+	// 替换同名规则前先关闭旧规则
+	if old, exists := e.rules[name]; exists {
+		e.shutdownRule(old)
 	}
+	e.enrichers.remove(name)
 
 	e.rules[name] = rule
+	loaded = true
 	e.logger.Infof("Loaded Wasm rule: %s from %s", name, wasmPath)
 
 	return nil
 }
 
+// loadEnricher 加载富化规则，替换同名的规则
+func (e *Engine) loadEnricher(name, wasmPath string, module *wasmtime.Module, manifest *RuleManifest) error {
+	output, err := e.outputs.open(name, e.config.ruleConfig(name).DiscardOutput)
+	if err != nil {
+		return err
+	}
+
+	en, err := newEnricher(e.engine, e.config, name, module, manifest, output)
+	if err != nil {
+		output.close()
+		return err
+	}
+
+	if old, exists := e.rules[name]; exists {
+		e.shutdownRule(old)
+		delete(e.rules, name)
+	}
+
+	e.enrichers.add(en)
+	e.logger.Infof("Loaded Wasm enricher: %s from %s", name, wasmPath)
+
+	return nil
+}
+
 // LoadRulesFromDir 从目录加载所有 Wasm 规则
 func (e *Engine) LoadRulesFromDir(rulesDir string) error {
 	return filepath.Walk(rulesDir, func(path string, info os.FileInfo, err error) error {
@@ -109,10 +234,13 @@ func (e *Engine) LoadRulesFromDir(rulesDir string) error {
 			return err
 		}
 
+		// 跳过隐藏目录（例如已安装规则的历史版本）
+		if info.IsDir() && path != rulesDir && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+
 		if filepath.Ext(path) == ".wasm" {
-			name := filepath.Base(path)
-			name = name[:len(name)-5] // 移除 .wasm 扩展名
-			return e.LoadRule(name, path)
+			return e.LoadRule(ruleName(path), path)
 		}
 
 		return nil
@@ -124,108 +252,165 @@ func (e *Engine) UnloadRule(name string) error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	if _, exists := e.rules[name]; !exists {
+	if e.enrichers.remove(name) {
+		e.logger.Infof("Unloaded Wasm enricher: %s", name)
+		return nil
+	}
+
+	rule, exists := e.rules[name]
+	if !exists {
 		return fmt.Errorf("rule %s not found", name)
 	}
 
+	e.shutdownRule(rule)
 	delete(e.rules, name)
 	e.logger.Infof("Unloaded Wasm rule: %s", name)
 
 	return nil
 }
 
-// DetectThreat 使用所有规则检测威胁
+// DetectThreat 使用所有规则检测威胁，满足追踪条件的规则调用写入日志
 func (e *Engine) DetectThreat(ctx context.Context, event *events.Event) ([]*events.DetectionResult, error) {
+	traces := newTraceRecorder(e.tracer, false)
+	results, err := e.detect(ctx, event, traces)
+	traces.log(e.logger)
+	return results, err
+}
+
+// Explain 用所有规则检测单个事件，并返回每个规则的追踪记录
+func (e *Engine) Explain(ctx context.Context, event *events.Event) ([]*events.DetectionResult, []*RuleTrace, error) {
+	traces := newTraceRecorder(e.tracer, true)
+	results, err := e.detect(ctx, event, traces)
+	return results, traces.sorted(), err
+}
+
+// detect 依次执行富化规则和检测规则，traces 不为 nil 时记录满足追踪条件的规则调用
+func (e *Engine) detect(ctx context.Context, event *events.Event, traces *traceRecorder) ([]*events.DetectionResult, error) {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
+	if err := normalizeSchemaVersion(event); err != nil {
+		return nil, err
+	}
+
 	var results []*events.DetectionResult
 
-	// 将事件转换为 JSON
-	eventData, err := event.ToJSON()
-	if err != nil {
-		return nil, fmt.Errorf("failed to serialize event: %w", err)
+	// 先按顺序执行富化规则
+	view := newEventView(event)
+	if err := e.enrichers.run(view, traces); err != nil {
+		return nil, err
 	}
 
-	// 对每个规则执行检测
+	// 对每个规则执行检测，不满足预过滤条件的规则不调用模块
 	for _, rule := range e.rules {
-		result, err := e.runRule(ctx, rule, eventData, event)
+		trace := traces.start(rule.Name, KindDetector, view)
+
+		// 规则支持的结构版本低于当前版本时发送转换后的事件
+		ruleView, err := view.at(rule.schemaVersion)
 		if err != nil {
-			e.logger.Warnf("Rule %s failed: %v", rule.Name, err)
+			trace.fail(err)
+			e.logger.Warnf("Rule %s skipped: %v", rule.Name, err)
+			continue
+		}
+		if trace != nil {
+			trace.SchemaVersion = rule.schemaVersion
+		}
+
+		if !rule.prefilter.match(ruleView) {
+			rule.counters.skipped.Add(1)
+			trace.skip()
 			continue
 		}
+		rule.counters.invocations.Add(1)
+
+		// 将事件转换为 JSON，声明了字段的规则只接收这些字段
+		eventData, err := ruleView.payload(rule.projection)
+		if err != nil {
+			return nil, err
+		}
 
-		if result != nil {
-			results = append(results, result)
+		ruleResults, err := e.runRule(ctx, rule, eventData, event, trace)
+		if err != nil {
+			trace.fail(err)
+			e.logger.Warnf("Rule %s failed: %v", rule.Name, err)
+			continue
 		}
+
+		results = append(results, ruleResults...)
 	}
 
 	return results, nil
 }
 
 // runRule 运行单个规则
-func (e *Engine) runRule(ctx context.Context, rule *WasmRule, eventData []byte, event *events.Event) (*events.DetectionResult, error) {
+func (e *Engine) runRule(ctx context.Context, rule *WasmRule, eventData []byte, event *events.Event, trace *RuleTrace) ([]*events.DetectionResult, error) {
 	rule.mu.Lock()
 	defer rule.mu.Unlock()
 
-	// 分配内存并写入事件数据
-	memory := rule.Instance.GetExport(rule.Store, "memory").Memory()
-	if memory == nil {
-		return nil, fmt.Errorf("rule %s has no memory export", rule.Name)
+	// 写入事件数据并调用检测函数
+	findings, err := rule.inst.runDetect(eventData, trace)
+	rule.output.flushTrace(event.ID, trace)
+	if err != nil {
+		return nil, err
+	}
+	if trace != nil {
+		trace.Findings = rule.scoring.trace(findings)
 	}
 
-	// 在 Wasm 内存中分配空间
-	dataPtr := int32(1024) // 简单的固定偏移
-	dataLen := int32(len(eventData))
+	// 映射严重程度和置信度，并应用输出过滤条件
+	return rule.scoring.results(rule.Name, findings, event), nil
+}
 
-	// 写入事件数据到 Wasm 内存
-	memoryData := memory.UnsafeData(rule.Store)
-	if len(memoryData) < int(dataPtr)+len(eventData) {
-		return nil, fmt.Errorf("insufficient memory in rule %s", rule.Name)
-	}
+// Tick 调用所有规则的 tick 钩子，返回定时产生的检测结果
+func (e *Engine) Tick(ctx context.Context, now time.Time) ([]*events.DetectionResult, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
 
-	copy(memoryData[dataPtr:], eventData)
+	var results []*events.DetectionResult
 
-	// 调用检测函数
-	result, err := rule.DetectFn.Call(rule.Store, dataPtr, dataLen)
-	if err != nil {
-		return nil, fmt.Errorf("failed to call detect function in rule %s: %w", rule.Name, err)
-	}
+	for _, rule := range e.rules {
+		if rule.inst.tick == nil {
+			continue
+		}
 
-	// 解析结果 - Wasmtime 返回的是 Val 类型
-	if result == nil {
-		return nil, fmt.Errorf("rule %s returned no result", rule.Name)
+		ruleResults, err := e.tickRule(rule, now)
+		if err != nil {
+			e.logger.Warnf("Rule %s tick failed: %v", rule.Name, err)
+			continue
+		}
+
+		results = append(results, ruleResults...)
 	}
 
-	// 转换为 int32
-	threatLevel := result.(int32)
-	if threatLevel > 0 {
-		return &events.DetectionResult{
-			RuleName:    rule.Name,
-			Severity:    e.getSeverityLevel(threatLevel),
-			Threat:      true,
-			Confidence:  float64(threatLevel) / 10.0, // 简单的置信度计算
-			Description: fmt.Sprintf("Threat detected by rule %s", rule.Name),
-			Event:       *event,
-		}, nil
+	return results, nil
+}
+
+// tickRule 调用单个规则的 tick 钩子
+func (e *Engine) tickRule(rule *WasmRule, now time.Time) ([]*events.DetectionResult, error) {
+	rule.mu.Lock()
+	defer rule.mu.Unlock()
+
+	event := newTickEvent(rule.Name, now)
+
+	findings, err := rule.inst.runTick(now)
+	rule.output.flush(event.ID)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil, nil
+	return rule.scoring.results(rule.Name, findings, event), nil
 }
 
-// getSeverityLevel 根据威胁级别返回严重程度
-func (e *Engine) getSeverityLevel(level int32) string {
-	switch {
-	case level >= 8:
-		return "critical"
-	case level >= 6:
-		return "high"
-	case level >= 4:
-		return "medium"
-	case level >= 2:
-		return "low"
-	default:
-		return "info"
+// shutdownRule 调用规则的 shutdown 钩子，并删除规则的捕获文件
+func (e *Engine) shutdownRule(rule *WasmRule) {
+	rule.mu.Lock()
+	defer rule.mu.Unlock()
+
+	err := rule.inst.runShutdown()
+	rule.output.flush("")
+	rule.output.close()
+	if err != nil {
+		e.logger.Warnf("Rule %s shutdown failed: %v", rule.Name, err)
 	}
 }
 
@@ -234,7 +419,7 @@ func (e *Engine) GetLoadedRules() []string {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
-	var rules []string
+	rules := e.enrichers.names()
 	for name := range e.rules {
 		rules = append(rules, name)
 	}
@@ -242,14 +427,33 @@ func (e *Engine) GetLoadedRules() []string {
 	return rules
 }
 
+// Stats 返回所有规则的调用统计
+func (e *Engine) Stats() []RuleStats {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	stats := e.enrichers.stats()
+	for _, rule := range e.rules {
+		stats = append(stats, rule.counters.snapshot(rule.Name, KindDetector))
+	}
+
+	return sortStats(stats)
+}
+
 // Close 关闭引擎并清理资源
 func (e *Engine) Close() error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	for name := range e.rules {
+	for name, rule := range e.rules {
+		e.shutdownRule(rule)
 		delete(e.rules, name)
 	}
+	e.enrichers.close()
+
+	if err := e.outputs.close(); err != nil {
+		e.logger.Warnf("Failed to remove rule output files: %v", err)
+	}
 
 	e.logger.Info("Wasm engine closed")
 	return nil
@@ -12,15 +12,23 @@ const (
 	EventTypeProcess EventType = "process"
 	EventTypeNetwork EventType = "network"
 	EventTypeFile    EventType = "file"
+	EventTypeTimer   EventType = "timer" // 规则 tick 钩子产生的定时事件
 )
 
+// CurrentSchemaVersion 宿主产生的事件结构版本
+//
+// 修改 Event 或 Data 中字段的结构时需要增加版本号，并在引擎中注册从新版本到旧版本的转换，
+// 以便只支持旧版本的规则继续工作。
+const CurrentSchemaVersion = 1
+
 // Event 表示一个系统事件
 type Event struct {
-	ID        string                 `json:"id"`
-	Type      EventType              `json:"type"`
-	Timestamp time.Time              `json:"timestamp"`
-	Source    string                 `json:"source"`
-	Data      map[string]interface{} `json:"data"`
+	SchemaVersion int                    `json:"schema_version"` // 事件结构版本，0 视为 CurrentSchemaVersion
+	ID            string                 `json:"id"`
+	Type          EventType              `json:"type"`
+	Timestamp     time.Time              `json:"timestamp"`
+	Source        string                 `json:"source"`
+	Data          map[string]interface{} `json:"data"`
 }
 
 // ProcessEvent 进程事件
@@ -38,6 +46,18 @@ type ProcessInfo struct {
 	CommandLine string `json:"command_line"`
 	User        string `json:"user"`
 	Group       string `json:"group"`
+	// Ancestors 祖先进程，从父进程开始依次向上
+	Ancestors []ProcessAncestor `json:"ancestors,omitempty"`
+}
+
+// ProcessAncestor 祖先进程信息
+type ProcessAncestor struct {
+	PID         int32  `json:"pid"`
+	Name        string `json:"name"`
+	Executable  string `json:"executable"`
+	CommandLine string `json:"command_line"`
+	User        string `json:"user"`
+	Exited      bool   `json:"exited,omitempty"` // 是否已经退出
 }
 
 // NetworkEvent 网络事件
@@ -54,8 +74,12 @@ type NetworkInfo struct {
 	DestIP      string `json:"dest_ip"`
 	DestPort    int    `json:"dest_port"`
 	Direction   string `json:"direction"`
+	State       string `json:"state,omitempty"` // TCP 状态，例如 ESTABLISHED、SYN_SENT、LISTEN
 	DataSize    int64  `json:"data_size"`
+	PID         int32  `json:"pid,omitempty"` // 持有套接字的进程，0 表示未知
 	ProcessName string `json:"process_name"`
+	Executable  string `json:"executable,omitempty"`
+	User        string `json:"user,omitempty"`
 }
 
 // FileEvent 文件事件
@@ -68,7 +92,9 @@ type FileEvent struct {
 type FileInfo struct {
 	Path        string `json:"path"`
 	Operation   string `json:"operation"`
+	NewPath     string `json:"new_path,omitempty"` // rename：新路径，移出监控目录时为空
 	Permissions string `json:"permissions"`
+	PID         int32  `json:"pid,omitempty"` // 操作文件的进程，0 表示未知
 	ProcessName string `json:"process_name"`
 	User        string `json:"user"`
 }
@@ -76,7 +102,9 @@ type FileInfo struct {
 // DetectionResult 检测结果
 type DetectionResult struct {
 	RuleName    string                 `json:"rule_name"`
+	SubRuleID   string                 `json:"sub_rule_id,omitempty"`
 	Severity    string                 `json:"severity"`
+	ThreatLevel int32                  `json:"threat_level"`
 	Threat      bool                   `json:"threat"`
 	Confidence  float64                `json:"confidence"`
 	Description string                 `json:"description"`
@@ -52,16 +52,18 @@ func (l *LogOutputHandler) Handle(result *events.DetectionResult) error {
 
 	// 格式化输出
 	logEntry := map[string]interface{}{
-		"timestamp":   time.Now().Format(time.RFC3339),
-		"rule_name":   result.RuleName,
-		"severity":    result.Severity,
-		"threat":      result.Threat,
-		"confidence":  result.Confidence,
-		"description": result.Description,
-		"event_type":  result.Event.Type,
-		"event_id":    result.Event.ID,
-		"source":      result.Event.Source,
-		"metadata":    result.Metadata,
+		"timestamp":    time.Now().Format(time.RFC3339),
+		"rule_name":    result.RuleName,
+		"sub_rule_id":  result.SubRuleID,
+		"severity":     result.Severity,
+		"threat_level": result.ThreatLevel,
+		"threat":       result.Threat,
+		"confidence":   result.Confidence,
+		"description":  result.Description,
+		"event_type":   result.Event.Type,
+		"event_id":     result.Event.ID,
+		"source":       result.Event.Source,
+		"metadata":     result.Metadata,
 	}
 
 	// 添加事件特定数据
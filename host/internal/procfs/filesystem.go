@@ -0,0 +1,42 @@
+package procfs
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// FileSystem 只读文件系统，路径为相对根目录、以斜杠分隔的路径，例如 proc/1/stat、etc/passwd
+//
+// 与 io/fs.FS 不同，FileSystem 需要读取符号链接本身（/proc/<pid>/exe 和 /proc/<pid>/fd/*）。
+type FileSystem interface {
+	ReadFile(name string) ([]byte, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	Readlink(name string) (string, error)
+}
+
+// DirFS 以本机目录为根的文件系统，例如 / 或容器中挂载的宿主机根目录 /host
+//
+// 符号链接不会被解析到根目录之外：Readlink 返回链接内容本身，
+// 而 /proc 中的链接内容（可执行文件路径、socket:[inode]）本来就是相对于宿主机的。
+type DirFS string
+
+// Path 返回 name 在本机上的路径
+func (d DirFS) Path(name string) string {
+	return filepath.Join(string(d), filepath.FromSlash(name))
+}
+
+// ReadFile 读取文件内容
+func (d DirFS) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(d.Path(name))
+}
+
+// ReadDir 列出目录
+func (d DirFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(d.Path(name))
+}
+
+// Readlink 读取符号链接的内容
+func (d DirFS) Readlink(name string) (string, error) {
+	return os.Readlink(d.Path(name))
+}
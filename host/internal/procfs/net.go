@@ -0,0 +1,263 @@
+package procfs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// NetProtocols /proc/net 下的套接字表
+var NetProtocols = []string{"tcp", "tcp6", "udp", "udp6", "raw", "raw6"}
+
+// tcpStates 内核 TCP 状态编号到名称的映射，见 include/net/tcp_states.h
+//
+// UDP 和 raw 套接字复用这些编号：已连接为 ESTABLISHED，未连接为 CLOSE。
+var tcpStates = map[uint64]string{
+	0x01: "ESTABLISHED",
+	0x02: "SYN_SENT",
+	0x03: "SYN_RECV",
+	0x04: "FIN_WAIT1",
+	0x05: "FIN_WAIT2",
+	0x06: "TIME_WAIT",
+	0x07: "CLOSE",
+	0x08: "CLOSE_WAIT",
+	0x09: "LAST_ACK",
+	0x0A: "LISTEN",
+	0x0B: "CLOSING",
+	0x0C: "NEW_SYN_RECV",
+}
+
+// Socket /proc/net/<protocol> 中的一个套接字
+type Socket struct {
+	Protocol   string // tcp、tcp6、udp、udp6、raw、raw6
+	LocalIP    net.IP
+	LocalPort  int // raw 套接字为 IP 协议号
+	RemoteIP   net.IP
+	RemotePort int
+	State      string // TCP 状态名，未知编号为十六进制
+	TxQueue    uint64
+	RxQueue    uint64
+	UID        uint32
+	Inode      uint64 // 套接字 inode，与 /proc/<pid>/fd 中的 socket:[inode] 对应
+}
+
+// Transport 返回不区分 IP 版本的协议名：tcp、udp 或 raw
+func (s *Socket) Transport() string {
+	return strings.TrimSuffix(s.Protocol, "6")
+}
+
+// Listening 套接字是否在等待连接：TCP 的 LISTEN，或绑定在临时端口范围 ephemeral 之外的未连接 UDP
+//
+// 未连接的 UDP 客户端套接字同样绑定了端口，无法与服务端直接区分。客户端通常使用内核分配的临时端口，
+// 因此只把绑定在临时端口范围之外的 UDP 套接字视为服务端；绑定在临时端口范围内的 UDP 服务端会被漏掉。
+func (s *Socket) Listening(ephemeral PortRange) bool {
+	switch s.Transport() {
+	case "tcp":
+		return s.State == "LISTEN"
+	case "udp":
+		return s.State == "CLOSE" && s.LocalPort != 0 && s.RemotePort == 0 && !ephemeral.Contains(s.LocalPort)
+	}
+	return false
+}
+
+// PortRange 端口范围，包含两端
+type PortRange struct {
+	Low  int
+	High int
+}
+
+// Contains 端口是否在范围内
+func (r PortRange) Contains(port int) bool {
+	return port >= r.Low && port <= r.High
+}
+
+// DefaultLocalPortRange Linux 默认的临时端口范围
+var DefaultLocalPortRange = PortRange{Low: 32768, High: 60999}
+
+// LocalPortRange 读取内核分配临时端口的范围 /proc/sys/net/ipv4/ip_local_port_range（IPv6 共用），
+// 读取失败时返回 DefaultLocalPortRange
+func (fs *FS) LocalPortRange() PortRange {
+	data, err := fs.sys.ReadFile(procDir + "/sys/net/ipv4/ip_local_port_range")
+	if err != nil {
+		return DefaultLocalPortRange
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 {
+		return DefaultLocalPortRange
+	}
+	low, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return DefaultLocalPortRange
+	}
+	high, err := strconv.Atoi(fields[1])
+	if err != nil || high < low {
+		return DefaultLocalPortRange
+	}
+	return PortRange{Low: low, High: high}
+}
+
+// ReadSockets 读取所有协议的套接字表，内核不支持的协议（如关闭了 IPv6）跳过
+func (fs *FS) ReadSockets() ([]Socket, error) {
+	var sockets []Socket
+	for _, protocol := range NetProtocols {
+		result, err := fs.ReadProtocolSockets(protocol)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		sockets = append(sockets, result...)
+	}
+	return sockets, nil
+}
+
+// ReadProtocolSockets 读取并解析 /proc/net/<protocol>
+func (fs *FS) ReadProtocolSockets(protocol string) ([]Socket, error) {
+	data, err := fs.sys.ReadFile(procDir + "/net/" + protocol)
+	if err != nil {
+		return nil, err
+	}
+
+	var sockets []Socket
+	for i, line := range strings.Split(string(data), "\n") {
+		if i == 0 || strings.TrimSpace(line) == "" {
+			continue // 跳过标题行和空行
+		}
+		socket, err := parseSocket(protocol, line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid /proc/net/%s line %d: %w", protocol, i+1, err)
+		}
+		sockets = append(sockets, socket)
+	}
+
+	return sockets, nil
+}
+
+// parseSocket 解析套接字表的一行
+//
+// 字段依次为 sl、local_address、rem_address、st、tx_queue:rx_queue、tr:tm->when、retrnsmt、uid、timeout、inode。
+func parseSocket(protocol, line string) (Socket, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 10 {
+		return Socket{}, fmt.Errorf("expected at least 10 fields, got %d", len(fields))
+	}
+
+	socket := Socket{Protocol: protocol}
+	var err error
+	if socket.LocalIP, socket.LocalPort, err = parseSocketAddress(fields[1]); err != nil {
+		return Socket{}, fmt.Errorf("local address: %w", err)
+	}
+	if socket.RemoteIP, socket.RemotePort, err = parseSocketAddress(fields[2]); err != nil {
+		return Socket{}, fmt.Errorf("remote address: %w", err)
+	}
+
+	state, err := strconv.ParseUint(fields[3], 16, 8)
+	if err != nil {
+		return Socket{}, fmt.Errorf("state: %w", err)
+	}
+	if name, ok := tcpStates[state]; ok {
+		socket.State = name
+	} else {
+		socket.State = fields[3]
+	}
+
+	if tx, rx, ok := strings.Cut(fields[4], ":"); ok {
+		socket.TxQueue, _ = strconv.ParseUint(tx, 16, 64)
+		socket.RxQueue, _ = strconv.ParseUint(rx, 16, 64)
+	}
+
+	uid, err := strconv.ParseUint(fields[7], 10, 32)
+	if err != nil {
+		return Socket{}, fmt.Errorf("uid: %w", err)
+	}
+	socket.UID = uint32(uid)
+
+	if socket.Inode, err = strconv.ParseUint(fields[9], 10, 64); err != nil {
+		return Socket{}, fmt.Errorf("inode: %w", err)
+	}
+
+	return socket, nil
+}
+
+// parseSocketAddress 解析 "IP:端口" 形式的十六进制地址
+//
+// IP 按 32 位字输出，每个字是主机字节序：IPv4 为 1 个字，IPv6 为 4 个字。
+func parseSocketAddress(addr string) (net.IP, int, error) {
+	ipHex, portHex, ok := strings.Cut(addr, ":")
+	if !ok || (len(ipHex) != 8 && len(ipHex) != 32) {
+		return nil, 0, fmt.Errorf("invalid address %q", addr)
+	}
+
+	ip := make(net.IP, len(ipHex)/2)
+	for i := 0; i < len(ipHex); i += 8 {
+		word, err := strconv.ParseUint(ipHex[i:i+8], 16, 32)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid address %q: %w", addr, err)
+		}
+		binary.NativeEndian.PutUint32(ip[i/2:], uint32(word))
+	}
+
+	port, err := strconv.ParseUint(portHex, 16, 16)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid port in %q: %w", addr, err)
+	}
+
+	return ip, int(port), nil
+}
+
+// SocketOwners 扫描所有进程的 /proc/<pid>/fd，返回套接字 inode 到持有进程的映射
+//
+// 多个进程共享同一个套接字时（例如 fork 之后）取 PID 最小的进程。
+// 无权限读取的进程（非 root 运行时）和扫描期间退出的进程被跳过。
+func (fs *FS) SocketOwners() (map[uint64]int32, error) {
+	pids, err := fs.PIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	owners := make(map[uint64]int32)
+	for _, pid := range pids {
+		dir := pidPath(pid, "fd")
+		entries, err := fs.sys.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			link, err := fs.sys.Readlink(dir + "/" + entry.Name())
+			if err != nil {
+				continue
+			}
+			inode, ok := socketInode(link)
+			if !ok {
+				continue
+			}
+			if owner, ok := owners[inode]; !ok || pid < owner {
+				owners[inode] = pid
+			}
+		}
+	}
+
+	return owners, nil
+}
+
+// socketInode 解析 "socket:[inode]" 形式的文件描述符链接
+func socketInode(link string) (uint64, bool) {
+	value, ok := strings.CutPrefix(link, "socket:[")
+	if !ok {
+		return 0, false
+	}
+	value, ok = strings.CutSuffix(value, "]")
+	if !ok {
+		return 0, false
+	}
+	inode, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return inode, true
+}
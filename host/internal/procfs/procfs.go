@@ -0,0 +1,255 @@
+// Package procfs 直接读取 /proc 获取进程信息，不依赖 ps 等外部命令
+//
+// 所有读取都通过 FileSystem 进行，根目录可以是本机的 /、挂载到容器中的宿主机根目录，
+// 或者从快照归档加载的内存文件系统。
+package procfs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// procDir FileSystem 中 procfs 的路径
+const procDir = "proc"
+
+// clockTicks /proc 中时间字段的单位（USER_HZ），Linux 上固定为每秒 100
+const clockTicks = 100
+
+// Process 从 /proc/<pid> 读取的进程信息
+type Process struct {
+	PID         int32
+	PPID        int32
+	Name        string // /proc/<pid>/stat 中的 comm，最多 15 个字符
+	State       string // 进程状态，例如 R、S、Z
+	StartTime   uint64 // 进程启动时间（系统启动以来的时钟滴答数），与 PID 一起唯一标识进程
+	Executable  string // /proc/<pid>/exe 指向的路径，内核线程或无权限时为空
+	CommandLine string // 以空格连接的参数，内核线程为空
+	UID         uint32 // real UID
+	GID         uint32 // real GID
+	StartedAt   time.Time
+	ExitedAt    time.Time // 退出时间，仍在运行时为零值
+	ExitCode    int       // 退出码，仍在运行或未知时为 -1
+}
+
+// Exited 进程是否已退出
+func (p *Process) Exited() bool {
+	return !p.ExitedAt.IsZero()
+}
+
+// Lifetime 返回进程的运行时长，仍在运行时计算到 now
+func (p *Process) Lifetime(now time.Time) time.Duration {
+	end := now
+	if p.Exited() {
+		end = p.ExitedAt
+	}
+	if p.StartedAt.IsZero() || end.Before(p.StartedAt) {
+		return 0
+	}
+	return end.Sub(p.StartedAt)
+}
+
+// exit 返回记录了退出时间和退出码的副本，不修改可能被其他调用方持有的原进程
+func (p *Process) exit(at time.Time, exitCode int) *Process {
+	exited := *p
+	exited.ExitedAt = at
+	exited.ExitCode = exitCode
+	return &exited
+}
+
+// FS 通过 FileSystem 读取 procfs
+type FS struct {
+	sys FileSystem
+	now func() time.Time // 读取 /proc/uptime 时的时间，快照为采集时间
+
+	bootTimeOnce sync.Once
+	bootTime     time.Time
+}
+
+// NewFS 创建读取 sys 中 procfs 的 FS，now 返回 sys 内容对应的时间
+func NewFS(sys FileSystem, now func() time.Time) *FS {
+	return &FS{sys: sys, now: now}
+}
+
+// Host 返回读取 root 下 procfs 的 FS，root 为 / 时读取本机
+func Host(root string) *FS {
+	return NewFS(DirFS(root), time.Now)
+}
+
+// FileSystem 返回底层文件系统
+func (fs *FS) FileSystem() FileSystem {
+	return fs.sys
+}
+
+// Live 是否读取的是本机文件系统（而不是快照），只有这时才能结合内核接口（netlink 等）的数据
+func (fs *FS) Live() bool {
+	_, ok := fs.sys.(DirFS)
+	return ok
+}
+
+// Self 返回本进程在该 procfs 中的 PID，即 /proc/self 指向的进程，读取失败时为 0
+//
+// 快照中为采集快照的进程，它自身的信息不会被采集。
+func (fs *FS) Self() int32 {
+	link, err := fs.sys.Readlink(procDir + "/self")
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.ParseInt(link, 10, 32)
+	if err != nil {
+		return 0
+	}
+	return int32(pid)
+}
+
+// BootTime 返回系统启动时间，由当前时间减去 /proc/uptime 得到，读取失败时为零值
+//
+// /proc/stat 中的 btime 只精确到秒，不适合计算短命进程的运行时长。
+func (fs *FS) BootTime() time.Time {
+	fs.bootTimeOnce.Do(func() {
+		data, err := fs.sys.ReadFile(procDir + "/uptime")
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(string(data))
+		if len(fields) == 0 {
+			return
+		}
+		uptime, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return
+		}
+		fs.bootTime = fs.now().Add(-time.Duration(uptime * float64(time.Second)))
+	})
+	return fs.bootTime
+}
+
+// PIDs 列出 /proc 下所有进程的 PID
+func (fs *FS) PIDs() ([]int32, error) {
+	entries, err := fs.sys.ReadDir(procDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read /proc: %w", err)
+	}
+
+	pids := make([]int32, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		pid, err := strconv.ParseInt(entry.Name(), 10, 32)
+		if err != nil {
+			continue
+		}
+		pids = append(pids, int32(pid))
+	}
+
+	return pids, nil
+}
+
+// ReadProcess 读取进程的 stat、status、cmdline 和 exe
+func (fs *FS) ReadProcess(pid int32) (*Process, error) {
+	proc, err := fs.readStat(pid)
+	if err != nil {
+		return nil, err
+	}
+	fs.readDetails(proc)
+	return proc, nil
+}
+
+// readStat 读取并解析 /proc/<pid>/stat
+func (fs *FS) readStat(pid int32) (*Process, error) {
+	data, err := fs.sys.ReadFile(pidPath(pid, "stat"))
+	if err != nil {
+		return nil, err
+	}
+	proc, err := parseStat(pid, string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	// 启动时间只精确到 1/100 秒，且受系统时钟调整影响，只用于计算运行时长
+	if boot := fs.BootTime(); !boot.IsZero() {
+		proc.StartedAt = boot.Add(time.Duration(proc.StartTime) * time.Second / clockTicks)
+	}
+
+	return proc, nil
+}
+
+// parseStat 解析 stat 文件内容，comm 可能包含空格和括号，以最后一个 ")" 为界
+func parseStat(pid int32, stat string) (*Process, error) {
+	start := strings.IndexByte(stat, '(')
+	end := strings.LastIndexByte(stat, ')')
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("invalid stat for pid %d", pid)
+	}
+
+	// ")" 之后的字段从 state（第 3 个字段）开始
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 20 {
+		return nil, fmt.Errorf("invalid stat for pid %d: %d fields", pid, len(fields)+2)
+	}
+
+	ppid, err := strconv.ParseInt(fields[1], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ppid for pid %d: %w", pid, err)
+	}
+	startTime, err := strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start time for pid %d: %w", pid, err)
+	}
+
+	return &Process{
+		PID:       pid,
+		PPID:      int32(ppid),
+		Name:      stat[start+1 : end],
+		State:     fields[0],
+		StartTime: startTime,
+		ExitCode:  -1,
+	}, nil
+}
+
+// readDetails 读取 status、cmdline 和 exe，进程已退出或无权限时保留空值
+func (fs *FS) readDetails(proc *Process) {
+	fs.readStatus(proc)
+
+	if data, err := fs.sys.ReadFile(pidPath(proc.PID, "cmdline")); err == nil {
+		proc.CommandLine = strings.TrimSpace(strings.ReplaceAll(string(data), "\x00", " "))
+	}
+
+	proc.Executable, _ = fs.sys.Readlink(pidPath(proc.PID, "exe"))
+}
+
+// readStatus 从 /proc/<pid>/status 读取 real UID 和 GID
+func (fs *FS) readStatus(proc *Process) {
+	data, err := fs.sys.ReadFile(pidPath(proc.PID, "status"))
+	if err != nil {
+		return
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok || (key != "Uid" && key != "Gid") {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		id, err := strconv.ParseUint(fields[0], 10, 32)
+		if err != nil {
+			continue
+		}
+		if key == "Uid" {
+			proc.UID = uint32(id)
+		} else {
+			proc.GID = uint32(id)
+		}
+	}
+}
+
+// pidPath 返回 FileSystem 中 /proc/<pid>/<name> 的路径
+func pidPath(pid int32, name string) string {
+	return procDir + "/" + strconv.Itoa(int(pid)) + "/" + name
+}
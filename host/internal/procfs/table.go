@@ -0,0 +1,271 @@
+package procfs
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// 已退出进程的保留策略
+const (
+	exitedRetention    = 5 * time.Minute
+	maxExitedProcesses = 8192
+)
+
+// Table 进程表，每次扫描读取一次 /proc，供所有进程相关的代码路径复用
+//
+// 扫描时每个进程都重新读取 stat 和 status；PID 和启动时间不变且 comm 未变
+// （没有 exec）的进程复用上次读取的 cmdline 和 exe。
+//
+// 进程表同时记录进程的生命周期：扫描时消失的进程，或通过 Exit 报告退出的进程，
+// 会带着退出时间保留一段时间，以便在进程退出后仍能查到它的信息。
+// 父进程退出后子进程会被 init 或 subreaper 收养，进程表保留第一次读取到的 PPID，
+// 使祖先链指向真正创建它的进程。
+type Table struct {
+	fs        *FS
+	processes map[int32]*Process
+	exited    map[int32]*Process // 最近退出的进程，PID 复用时只保留最后一个
+	scannedAt time.Time
+	mu        sync.RWMutex
+}
+
+// NewTable 创建读取 fs 的空进程表
+func NewTable(fs *FS) *Table {
+	return &Table{
+		fs:        fs,
+		processes: make(map[int32]*Process),
+		exited:    make(map[int32]*Process),
+	}
+}
+
+// Scan 扫描 /proc 并替换进程表内容
+func (t *Table) Scan() error {
+	pids, err := t.fs.PIDs()
+	if err != nil {
+		return err
+	}
+
+	// 读取 /proc 时不持有锁，Add 和 Exit 可能同时修改进程表，这里使用副本
+	t.mu.RLock()
+	previous := make(map[int32]*Process, len(t.processes))
+	for pid, proc := range t.processes {
+		previous[pid] = proc
+	}
+	t.mu.RUnlock()
+
+	processes := make(map[int32]*Process, len(pids))
+	for _, pid := range pids {
+		proc, err := t.fs.readStat(pid)
+		if err != nil {
+			continue // 扫描期间退出的进程
+		}
+
+		old, ok := previous[pid]
+		if ok && old.StartTime == proc.StartTime {
+			proc.PPID = old.PPID
+		}
+		if ok && old.StartTime == proc.StartTime && old.Name == proc.Name {
+			proc.Executable = old.Executable
+			proc.CommandLine = old.CommandLine
+			t.fs.readStatus(proc)
+		} else {
+			t.fs.readDetails(proc)
+		}
+		processes[pid] = proc
+	}
+
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// 扫描期间通过 Exit 移出进程表的进程可能被扫描读到（僵尸进程），不再加回
+	for pid, old := range previous {
+		if _, running := t.processes[pid]; running {
+			continue
+		}
+		if proc, ok := processes[pid]; ok && proc.StartTime == old.StartTime {
+			delete(processes, pid)
+		}
+	}
+
+	for pid, old := range t.processes {
+		proc, ok := processes[pid]
+		// 扫描期间通过 Add 加入或更新的进程，比扫描结果新时保留
+		if old != previous[pid] && (!ok || proc.StartTime < old.StartTime) {
+			processes[pid] = old
+			continue
+		}
+		// 扫描之间退出的进程无法得到退出码，退出时间记为扫描时间
+		if !ok || proc.StartTime != old.StartTime {
+			t.exited[pid] = old.exit(now, -1)
+		}
+	}
+	t.processes = processes
+	t.scannedAt = now
+	t.prune(now)
+
+	return nil
+}
+
+// Add 添加或更新运行中的进程，用于在两次扫描之间记录实时收到的 fork/exec 事件
+func (t *Table) Add(proc *Process) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if old, ok := t.processes[proc.PID]; ok {
+		if old.StartTime == proc.StartTime {
+			proc.PPID = old.PPID
+		} else {
+			t.exited[old.PID] = old.exit(time.Now(), -1)
+		}
+	}
+	t.processes[proc.PID] = proc
+}
+
+// Exit 记录进程退出并返回带有生命周期信息的进程
+//
+// 进程不在进程表中时尝试从 /proc 读取（退出通知到达时进程可能还是僵尸进程），
+// 仍然读取不到时返回 false。
+func (t *Table) Exit(pid int32, at time.Time, exitCode int) (*Process, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	proc, running := t.processes[pid]
+	switch {
+	case running:
+		delete(t.processes, pid)
+	case t.exited[pid] != nil && t.exited[pid].ExitCode < 0:
+		// 扫描先发现了进程退出，补充退出码和更准确的退出时间
+		proc = t.exited[pid]
+	default:
+		var err error
+		if proc, err = t.fs.ReadProcess(pid); err != nil {
+			return nil, false
+		}
+	}
+
+	exited := proc.exit(at, exitCode)
+	t.exited[pid] = exited
+	// 过期记录由 Scan 定期清理，这里只在超过上限时清理
+	if len(t.exited) > maxExitedProcesses {
+		t.prune(at)
+	}
+
+	return exited, true
+}
+
+// ScanIfStale 上次扫描早于 maxAge 时重新扫描
+func (t *Table) ScanIfStale(maxAge time.Duration) error {
+	t.mu.RLock()
+	fresh := !t.scannedAt.IsZero() && time.Since(t.scannedAt) < maxAge
+	t.mu.RUnlock()
+
+	if fresh {
+		return nil
+	}
+	return t.Scan()
+}
+
+// Get 返回进程表中运行中的进程
+func (t *Table) Get(pid int32) (*Process, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	proc, ok := t.processes[pid]
+	return proc, ok
+}
+
+// Exited 返回最近退出的进程
+func (t *Table) Exited(pid int32) (*Process, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	proc, ok := t.exited[pid]
+	return proc, ok
+}
+
+// Processes 返回进程表中的所有进程，按 PID 排序
+func (t *Table) Processes() []*Process {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	processes := make([]*Process, 0, len(t.processes))
+	for _, proc := range t.processes {
+		processes = append(processes, proc)
+	}
+	sort.Slice(processes, func(i, j int) bool {
+		return processes[i].PID < processes[j].PID
+	})
+
+	return processes
+}
+
+// Ancestors 返回进程的祖先链，从父进程开始，最多 depth 层
+//
+// 祖先依次从运行中的进程、最近退出的进程和 /proc 中查找，启动时间晚于子进程的同 PID 进程
+// 是 PID 复用后的新进程，不会被当作祖先。找不到某一层时返回已经找到的部分。
+func (t *Table) Ancestors(proc *Process, depth int) []*Process {
+	var ancestors []*Process
+	seen := map[int32]bool{proc.PID: true}
+
+	child := proc
+	for len(ancestors) < depth && child.PPID > 0 && !seen[child.PPID] {
+		parent, ok := t.lookup(child.PPID, child.StartTime)
+		if !ok {
+			break
+		}
+		ancestors = append(ancestors, parent)
+		seen[parent.PID] = true
+		child = parent
+	}
+
+	return ancestors
+}
+
+// lookup 查找启动时间不晚于 startedBy 的进程，只在进程表中没有时读取 /proc 并加入进程表
+func (t *Table) lookup(pid int32, startedBy uint64) (*Process, bool) {
+	t.mu.RLock()
+	running, exited := t.processes[pid], t.exited[pid]
+	t.mu.RUnlock()
+
+	for _, proc := range []*Process{running, exited} {
+		if proc != nil && proc.StartTime <= startedBy {
+			return proc, true
+		}
+	}
+	if running != nil {
+		return nil, false
+	}
+
+	proc, err := t.fs.ReadProcess(pid)
+	if err != nil || proc.StartTime > startedBy {
+		return nil, false
+	}
+	t.Add(proc)
+
+	return proc, true
+}
+
+// prune 删除超过保留时间的已退出进程，数量超过上限时删除最早退出的进程，调用方需持有写锁
+func (t *Table) prune(now time.Time) {
+	for pid, proc := range t.exited {
+		if now.Sub(proc.ExitedAt) >= exitedRetention {
+			delete(t.exited, pid)
+		}
+	}
+	if len(t.exited) <= maxExitedProcesses {
+		return
+	}
+
+	exited := make([]*Process, 0, len(t.exited))
+	for _, proc := range t.exited {
+		exited = append(exited, proc)
+	}
+	sort.Slice(exited, func(i, j int) bool {
+		return exited[i].ExitedAt.Before(exited[j].ExitedAt)
+	})
+	for _, proc := range exited[:len(exited)-maxExitedProcesses] {
+		delete(t.exited, proc.PID)
+	}
+}
@@ -0,0 +1,152 @@
+package ruletest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wasm-threat-detector/host/internal/engine"
+	"github.com/wasm-threat-detector/host/internal/events"
+)
+
+// Fixture 规则测试用例，保存在规则目录的 fixtures/*.json 中
+type Fixture struct {
+	Name   string        `json:"-"`      // 用例名，取自文件名
+	Event  events.Event  `json:"event"`  // 输入事件
+	Expect []Expectation `json:"expect"` // 期望的检测结果，为空表示不应触发
+}
+
+// Expectation 期望的一条检测结果，未设置的字段不参与比较
+type Expectation struct {
+	SubRuleID string `json:"sub_rule_id"`
+	Severity  string `json:"severity"`
+}
+
+// Result 单个用例的运行结果
+type Result struct {
+	Fixture  string
+	Problems []string
+	Results  []*events.DetectionResult
+}
+
+// Passed 判断用例是否通过
+func (r Result) Passed() bool {
+	return len(r.Problems) == 0
+}
+
+// LoadFixtures 读取目录下的所有测试用例，按文件名排序
+func LoadFixtures(dir string) ([]Fixture, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	var fixtures []Fixture
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read fixture %s: %w", path, err)
+		}
+
+		var fixture Fixture
+		if err := json.Unmarshal(data, &fixture); err != nil {
+			return nil, fmt.Errorf("failed to parse fixture %s: %w", path, err)
+		}
+		fixture.Name = strings.TrimSuffix(filepath.Base(path), ".json")
+		fixtures = append(fixtures, fixture)
+	}
+
+	return fixtures, nil
+}
+
+// Run 加载规则并逐个运行测试用例
+//
+// 规则使用默认引擎配置运行，威胁级别大于 0 的结果都会输出。
+func Run(logger *logrus.Logger, name, wasmPath string, fixtures []Fixture) ([]Result, error) {
+	threatEngine := engine.NewSimpleEngine(logger)
+	defer threatEngine.Close()
+
+	if err := threatEngine.LoadRule(name, wasmPath); err != nil {
+		return nil, err
+	}
+
+	var results []Result
+	for _, fixture := range fixtures {
+		event := fixture.Event
+		if event.ID == "" {
+			event.ID = fixture.Name
+		}
+
+		detections, err := threatEngine.DetectThreat(context.Background(), &event)
+		result := Result{Fixture: fixture.Name, Results: detections}
+		if err != nil {
+			result.Problems = append(result.Problems, err.Error())
+		} else {
+			result.Problems = compare(fixture.Expect, detections)
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// compare 比较期望结果和实际检测结果，返回不一致之处
+func compare(expect []Expectation, detections []*events.DetectionResult) []string {
+	var problems []string
+	matched := make([]bool, len(detections))
+
+	for _, exp := range expect {
+		found := false
+		for i, detection := range detections {
+			if matched[i] || !exp.matches(detection) {
+				continue
+			}
+			matched[i] = true
+			found = true
+			break
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("missing detection %s", exp))
+		}
+	}
+
+	for i, detection := range detections {
+		if !matched[i] {
+			problems = append(problems, fmt.Sprintf("unexpected detection sub_rule_id=%q severity=%s", detection.SubRuleID, detection.Severity))
+		}
+	}
+
+	return problems
+}
+
+// matches 判断检测结果是否符合期望
+func (e Expectation) matches(detection *events.DetectionResult) bool {
+	if e.SubRuleID != "" && e.SubRuleID != detection.SubRuleID {
+		return false
+	}
+	if e.Severity != "" && e.Severity != detection.Severity {
+		return false
+	}
+	return true
+}
+
+// String 格式化期望结果
+func (e Expectation) String() string {
+	var parts []string
+	if e.SubRuleID != "" {
+		parts = append(parts, fmt.Sprintf("sub_rule_id=%q", e.SubRuleID))
+	}
+	if e.Severity != "" {
+		parts = append(parts, "severity="+e.Severity)
+	}
+	if len(parts) == 0 {
+		return "(any)"
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,113 @@
+package scaffold
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/wasm-threat-detector/host/internal/engine"
+	"github.com/wasm-threat-detector/host/internal/events"
+)
+
+// templates 各语言的规则项目模板，.tmpl 文件按 text/template 渲染
+//
+//go:embed all:templates
+var templates embed.FS
+
+// Languages 支持的规则语言
+var Languages = []string{"rust", "tinygo"}
+
+// namePattern 规则名称只允许小写字母、数字和连字符
+var namePattern = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// templateData 模板变量
+type templateData struct {
+	Name          string // 规则名称
+	CrateName     string // Rust crate 名称（连字符替换为下划线）
+	ABIVersion    int32  // 宿主当前的 ABI 版本
+	SchemaVersion int    // 宿主当前的事件结构版本
+}
+
+// Generate 在 dir 下生成指定语言的规则项目，返回生成的文件列表（相对路径）
+//
+// dir 已存在且不为空时返回错误，不覆盖已有文件。
+func Generate(dir, name, lang string) ([]string, error) {
+	if !namePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid rule name %q: use lowercase letters, digits and '-'", name)
+	}
+
+	root := "templates/" + lang
+	if _, err := fs.Stat(templates, root); err != nil {
+		return nil, fmt.Errorf("unsupported language %q (supported: %s)", lang, strings.Join(Languages, ", "))
+	}
+
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("directory %s already exists and is not empty", dir)
+	}
+
+	data := templateData{
+		Name:          name,
+		CrateName:     strings.ReplaceAll(name, "-", "_"),
+		ABIVersion:    engine.CurrentABIVersion,
+		SchemaVersion: events.CurrentSchemaVersion,
+	}
+
+	var files []string
+	err := fs.WalkDir(templates, root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel := strings.TrimPrefix(path, root+"/")
+		content, err := templates.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		if strings.HasSuffix(rel, ".tmpl") {
+			rel = strings.TrimSuffix(rel, ".tmpl")
+			if content, err = render(path, content, data); err != nil {
+				return err
+			}
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, content, 0644); err != nil {
+			return err
+		}
+
+		files = append(files, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate rule project: %w", err)
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// render 渲染模板文件
+func render(name string, content []byte, data templateData) ([]byte, error) {
+	tmpl, err := template.New(name).Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %w", name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to render template %s: %w", name, err)
+	}
+
+	return buf.Bytes(), nil
+}
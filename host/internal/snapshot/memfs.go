@@ -0,0 +1,131 @@
+package snapshot
+
+import (
+	"io/fs"
+	"path"
+	"sort"
+	"time"
+)
+
+// memFS 从归档加载到内存中的只读文件系统，实现 procfs.FileSystem
+type memFS struct {
+	files map[string]*memFile
+}
+
+// memFile 文件、目录或符号链接
+type memFile struct {
+	name     string
+	mode     fs.FileMode
+	data     []byte
+	link     string
+	modTime  time.Time
+	children []fs.DirEntry // 目录的子项，按名称排序
+}
+
+// newMemFS 创建只有根目录的文件系统
+func newMemFS() *memFS {
+	return &memFS{files: map[string]*memFile{
+		".": {name: ".", mode: fs.ModeDir | 0555},
+	}}
+}
+
+// add 添加文件，自动创建缺少的父目录；目录重复添加时保留已有子项
+func (m *memFS) add(name string, file *memFile) {
+	if existing, ok := m.files[name]; ok && existing.mode.IsDir() && file.mode.IsDir() {
+		return
+	}
+	if name != "." {
+		m.mkdirAll(path.Dir(name))
+	}
+	file.name = path.Base(name)
+	m.files[name] = file
+}
+
+// mkdirAll 创建目录及其父目录
+func (m *memFS) mkdirAll(dir string) {
+	if _, ok := m.files[dir]; ok {
+		return
+	}
+	m.add(dir, &memFile{mode: fs.ModeDir | 0555})
+}
+
+// index 建立每个目录的子项列表，加载完成后调用一次
+func (m *memFS) index() {
+	for name, file := range m.files {
+		if name == "." {
+			continue
+		}
+		parent := m.files[path.Dir(name)]
+		parent.children = append(parent.children, fs.FileInfoToDirEntry(file.info()))
+	}
+	for _, file := range m.files {
+		sort.Slice(file.children, func(i, j int) bool {
+			return file.children[i].Name() < file.children[j].Name()
+		})
+	}
+}
+
+// lookup 查找文件，不跟随符号链接
+func (m *memFS) lookup(op, name string) (*memFile, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	file, ok := m.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return file, nil
+}
+
+// ReadFile 读取文件内容
+func (m *memFS) ReadFile(name string) ([]byte, error) {
+	file, err := m.lookup("read", name)
+	if err != nil {
+		return nil, err
+	}
+	if !file.mode.IsRegular() {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrInvalid}
+	}
+	return file.data, nil
+}
+
+// ReadDir 列出目录
+func (m *memFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	file, err := m.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !file.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	return file.children, nil
+}
+
+// Readlink 读取符号链接的内容
+func (m *memFS) Readlink(name string) (string, error) {
+	file, err := m.lookup("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	if file.mode&fs.ModeSymlink == 0 {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return file.link, nil
+}
+
+// info 返回文件信息
+func (f *memFile) info() fs.FileInfo {
+	return memFileInfo{f}
+}
+
+// memFileInfo 实现 fs.FileInfo
+type memFileInfo struct {
+	file *memFile
+}
+
+func (i memFileInfo) Name() string       { return i.file.name }
+func (i memFileInfo) Size() int64        { return int64(len(i.file.data)) }
+func (i memFileInfo) Mode() fs.FileMode  { return i.file.mode }
+func (i memFileInfo) ModTime() time.Time { return i.file.modTime }
+func (i memFileInfo) IsDir() bool        { return i.file.mode.IsDir() }
+func (i memFileInfo) Sys() interface{}   { return nil }
@@ -0,0 +1,255 @@
+// Package snapshot 将收集器读取的 procfs 和 /etc 文件保存为归档，并在离线分析时作为文件系统加载
+package snapshot
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wasm-threat-detector/host/internal/procfs"
+)
+
+// FormatVersion 快照格式版本
+const FormatVersion = 1
+
+// metadataFile 归档中的元数据文件
+const metadataFile = "snapshot.json"
+
+// maxArchiveSize 加载归档时解压后的总大小上限
+const maxArchiveSize = 1 << 30
+
+// 采集的文件，路径与 procfs 读取的路径一致
+var (
+	// systemFiles 系统级文件，/etc 下的用户和组数据库供分析人员把事件中的 UID 和 GID 对应到名称
+	systemFiles = []string{"proc/uptime", "proc/sys/kernel/hostname", "proc/sys/net/ipv4/ip_local_port_range", "etc/passwd", "etc/group"}
+	// processFiles 每个进程除 stat 以外的文件
+	processFiles = []string{"status", "cmdline"}
+	// processLinks 每个进程的符号链接
+	processLinks = []string{"exe"}
+)
+
+// Metadata 快照元数据
+type Metadata struct {
+	FormatVersion int       `json:"format_version"`
+	CapturedAt    time.Time `json:"captured_at"`
+	Hostname      string    `json:"hostname"`
+	Processes     int       `json:"processes"` // 采集到的进程数
+}
+
+// Snapshot 加载到内存中的快照
+type Snapshot struct {
+	Metadata Metadata
+	files    *memFS
+}
+
+// FS 返回读取快照的 procfs，时间以采集时间为准
+func (s *Snapshot) FS() *procfs.FS {
+	capturedAt := s.Metadata.CapturedAt
+	return procfs.NewFS(s.files, func() time.Time { return capturedAt })
+}
+
+// Capture 采集 proc 中收集器会读取的文件，以 tar.gz 格式写入 w
+//
+// 采集期间退出或无权限读取的进程和文件被跳过，采集快照的进程本身不会被采集。
+func Capture(w io.Writer, proc *procfs.FS) (*Metadata, error) {
+	sys := proc.FileSystem()
+	meta := &Metadata{FormatVersion: FormatVersion, CapturedAt: time.Now()}
+	if data, err := sys.ReadFile("proc/sys/kernel/hostname"); err == nil {
+		meta.Hostname = strings.TrimSpace(string(data))
+	}
+
+	pids, err := proc.PIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	gz := gzip.NewWriter(w)
+	aw := &archiveWriter{tw: tar.NewWriter(gz), sys: sys, modTime: meta.CapturedAt}
+
+	for _, name := range systemFiles {
+		aw.copyFile(name)
+	}
+	aw.copyLink("proc/self")
+	for _, protocol := range procfs.NetProtocols {
+		aw.copyFile("proc/net/" + protocol)
+	}
+
+	self := proc.Self()
+	for _, pid := range pids {
+		if pid == self {
+			continue
+		}
+		dir := "proc/" + strconv.Itoa(int(pid))
+		// stat 是必需的，读不到说明进程已经退出
+		if !aw.copyFile(dir + "/stat") {
+			continue
+		}
+		meta.Processes++
+		for _, name := range processFiles {
+			aw.copyFile(dir + "/" + name)
+		}
+		for _, name := range processLinks {
+			aw.copyLink(dir + "/" + name)
+		}
+		aw.copyLinks(dir + "/fd")
+	}
+
+	if aw.err == nil {
+		data, err := json.MarshalIndent(meta, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		aw.write(&tar.Header{Typeflag: tar.TypeReg, Name: metadataFile, Mode: 0444, Size: int64(len(data))}, data)
+	}
+	if aw.err != nil {
+		return nil, fmt.Errorf("failed to write snapshot: %w", aw.err)
+	}
+	if err := aw.tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write snapshot: %w", err)
+	}
+
+	return meta, nil
+}
+
+// archiveWriter 把文件系统中的文件写入 tar 归档，记录第一个写入错误
+type archiveWriter struct {
+	tw      *tar.Writer
+	sys     procfs.FileSystem
+	modTime time.Time
+	err     error
+}
+
+// write 写入一个归档条目
+func (a *archiveWriter) write(header *tar.Header, data []byte) {
+	if a.err != nil {
+		return
+	}
+	header.ModTime = a.modTime
+	if a.err = a.tw.WriteHeader(header); a.err != nil {
+		return
+	}
+	if len(data) > 0 {
+		_, a.err = a.tw.Write(data)
+	}
+}
+
+// copyFile 复制文件，文件不存在或无法读取时返回 false
+func (a *archiveWriter) copyFile(name string) bool {
+	data, err := a.sys.ReadFile(name)
+	if err != nil {
+		return false
+	}
+	a.write(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0444, Size: int64(len(data))}, data)
+	return true
+}
+
+// copyLink 复制符号链接
+func (a *archiveWriter) copyLink(name string) {
+	link, err := a.sys.Readlink(name)
+	if err != nil {
+		return
+	}
+	a.write(&tar.Header{Typeflag: tar.TypeSymlink, Name: name, Linkname: link, Mode: 0777}, nil)
+}
+
+// copyLinks 复制目录及其中的符号链接，用于 /proc/<pid>/fd
+func (a *archiveWriter) copyLinks(dir string) {
+	entries, err := a.sys.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	a.write(&tar.Header{Typeflag: tar.TypeDir, Name: dir + "/", Mode: 0555}, nil)
+	for _, entry := range entries {
+		a.copyLink(dir + "/" + entry.Name())
+	}
+}
+
+// Open 加载快照归档
+func Open(name string) (*Snapshot, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer file.Close()
+
+	snapshot, err := Read(file)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snapshot %s: %w", name, err)
+	}
+	return snapshot, nil
+}
+
+// Read 从 r 读取 tar.gz 格式的快照
+func Read(r io.Reader) (*Snapshot, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	files := newMemFS()
+	var meta *Metadata
+	var total int64
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		name := path.Clean(strings.TrimSuffix(header.Name, "/"))
+		if !fs.ValidPath(name) || name == "." {
+			return nil, fmt.Errorf("invalid path %q in archive", header.Name)
+		}
+		total += header.Size
+		if total > maxArchiveSize {
+			return nil, fmt.Errorf("archive is larger than %d bytes", maxArchiveSize)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			files.add(name, &memFile{mode: fs.ModeDir | 0555, modTime: header.ModTime})
+		case tar.TypeSymlink:
+			files.add(name, &memFile{mode: fs.ModeSymlink | 0777, link: header.Linkname, modTime: header.ModTime})
+		case tar.TypeReg:
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+			if name == metadataFile {
+				meta = &Metadata{}
+				if err := json.Unmarshal(data, meta); err != nil {
+					return nil, fmt.Errorf("invalid %s: %w", metadataFile, err)
+				}
+				continue
+			}
+			files.add(name, &memFile{mode: 0444, data: data, modTime: header.ModTime})
+		}
+	}
+
+	if meta == nil {
+		return nil, fmt.Errorf("missing %s", metadataFile)
+	}
+	if meta.FormatVersion != FormatVersion {
+		return nil, fmt.Errorf("unsupported snapshot format version %d", meta.FormatVersion)
+	}
+	files.index()
+
+	return &Snapshot{Metadata: *meta, files: files}, nil
+}